@@ -0,0 +1,425 @@
+// Package asm assembles Hack assembly programs in memory.
+package asm
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/uu64/nand2tetris/assembler/hack"
+	"github.com/uu64/nand2tetris/assembler/internal/code"
+	"github.com/uu64/nand2tetris/assembler/internal/diag"
+	"github.com/uu64/nand2tetris/assembler/internal/parser"
+	"github.com/uu64/nand2tetris/assembler/internal/symboltable"
+)
+
+const (
+	// ROMSize is the number of words of the ROM.
+	ROMSize = 1 << 15
+	// varBase is the RAM address where variables are allocated from.
+	varBase = 16
+	// stackBase is the RAM address where the VM stack starts.
+	stackBase = 256
+	// screenBase is the RAM address of the memory map of the screen.
+	screenBase = 16384
+	// kbdAddr is the RAM address of the memory map of the keyboard.
+	kbdAddr = 24576
+)
+
+// Diagnostic describes a problem found at a specific position of an asm source.
+type Diagnostic = diag.Diagnostic
+
+// DiagnosticList is the error returned when the source has one or more problems.
+type DiagnosticList = diag.List
+
+// LineKind tells what a source line is assembled into.
+type LineKind int
+
+const (
+	// Blank is an empty or comment line.
+	Blank LineKind = iota
+	// Instruction is an A or C command which occupies a ROM word.
+	Instruction
+	// Label is an L command which binds a symbol to a ROM address.
+	Label
+)
+
+// Line is a source line and the ROM address it is assembled at.
+// For a label, Addr is the address the label is bound to.
+type Line struct {
+	File   string
+	Number int
+	Text   string
+	Kind   LineKind
+	Addr   int
+}
+
+// Program is the result of assembling an asm source.
+// Labels and Variables hold the symbols defined by the source, with their ROM and RAM addresses.
+// Saved is the number of ROM words removed by the optimizer.
+type Program struct {
+	Words     []uint16
+	Lines     []Line
+	Labels    map[string]int
+	Variables map[string]int
+	Saved     int
+	Warnings  DiagnosticList
+
+	symbolTable *symboltable.SymbolTable
+}
+
+// Symbols returns the predefined symbols, the labels and the variables with their addresses.
+func (p *Program) Symbols() map[string]int {
+	return p.symbolTable.Entries()
+}
+
+type Assembler struct {
+	// Strict rejects the alternative spellings of comp and dest,
+	// which are accepted by the newer nand2tetris tools, for coursework grading.
+	Strict bool
+	// Optimize applies peephole optimizations, which assume that ROM addresses are referenced only by labels.
+	Optimize bool
+
+	name        string
+	symbolTable *symboltable.SymbolTable
+	labels      map[string]int
+	variables   map[string]int
+	labelAt     map[string]parser.Row
+	diags       diag.List
+	warnings    diag.List
+
+	// relocatable leaves the symbols which are not defined in the source to the linker
+	relocatable bool
+	relocs      []Reloc
+	// globals are the labels declared by .global, which an object exports
+	globals map[string]parser.Row
+}
+
+// New returns an Assembler. name is used as the file name of diagnostics
+// and .include paths in the source are resolved from its directory.
+func New(name string) *Assembler {
+	return &Assembler{name: name}
+}
+
+// Assemble assembles the asm source read from r.
+func Assemble(r io.Reader) (*Program, error) {
+	return New("").Assemble(r)
+}
+
+// Assemble assembles the asm source read from r.
+// If the source has problems, the returned error is a DiagnosticList.
+func (a *Assembler) Assemble(r io.Reader) (*Program, error) {
+	a.symbolTable = symboltable.New()
+	a.labels = map[string]int{}
+	a.variables = map[string]int{}
+	a.labelAt = map[string]parser.Row{}
+	a.diags = nil
+	a.warnings = nil
+	a.relocs = nil
+
+	pp := parser.NewPreprocessor()
+	rows, err := pp.Process(a.name, r)
+	if err != nil {
+		return nil, err
+	}
+	a.globals = pp.Globals()
+
+	saved := 0
+	if a.Optimize {
+		var ok bool
+		rows, saved, ok = optimize(rows, a.globals)
+		if !ok {
+			a.warnings = append(a.warnings, &diag.Diagnostic{
+				File:    a.name,
+				Message: "optimization is skipped because a constant is used as a jump target",
+			})
+		}
+	}
+
+	if err := a.scanSymbol(rows); err != nil {
+		return nil, err
+	}
+	for name, at := range a.globals {
+		if _, ok := a.labels[name]; !ok {
+			a.diags = append(a.diags, &diag.Diagnostic{
+				File:    at.File,
+				Line:    at.Line,
+				Column:  nameColumn(at.Text, name),
+				Text:    name,
+				Message: "global label is not defined",
+			})
+		}
+	}
+
+	words, lines, err := a.parse(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	a.diags.Sort()
+	if err := a.diags.Err(); err != nil {
+		return nil, err
+	}
+
+	return &Program{
+		Words:       words,
+		Lines:       lines,
+		Labels:      a.labels,
+		Variables:   a.variables,
+		Saved:       saved,
+		Warnings:    a.warnings,
+		symbolTable: a.symbolTable,
+	}, nil
+}
+
+// report records a diagnostic found in the source.
+func (a *Assembler) report(p *parser.Parser, col int, text, msg string, expected ...string) {
+	a.diags = append(a.diags, &diag.Diagnostic{
+		File:     p.File(),
+		Line:     p.Line(),
+		Column:   col,
+		Text:     text,
+		Message:  msg,
+		Expected: expected,
+	})
+}
+
+// warn records a warning found in the source.
+func (a *Assembler) warn(p *parser.Parser, col int, text, msg string) {
+	a.warnings = append(a.warnings, &diag.Diagnostic{
+		File:    p.File(),
+		Line:    p.Line(),
+		Column:  col,
+		Text:    text,
+		Message: msg,
+	})
+}
+
+// advance reads the next command. A syntax error is recorded if reportSyntax is true,
+// and false is returned so that the caller skips the row.
+func (a *Assembler) advance(p *parser.Parser, reportSyntax bool) (bool, error) {
+	err := p.Advance()
+	if err == nil {
+		return true, nil
+	}
+
+	var d *diag.Diagnostic
+	if !errors.As(err, &d) {
+		return false, err
+	}
+	if reportSyntax {
+		a.diags = append(a.diags, d)
+	}
+	return false, nil
+}
+
+func (a *Assembler) scanSymbol(rows []parser.Row) error {
+	p := parser.NewRows(rows)
+
+	// scan
+	romAddr := 0
+	for p.HasMoreCommands() {
+		ok, err := a.advance(p, true)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+
+		switch p.CommandType() {
+		case parser.A_CMD, parser.C_CMD:
+			romAddr += 1
+		case parser.L_CMD:
+			symbol := p.Symbol()
+			if at, ok := a.labelAt[symbol]; ok {
+				a.report(p, p.SymbolColumn(), symbol, fmt.Sprintf("duplicate label, first defined at %s", position(p, at)))
+				continue
+			}
+			if a.symbolTable.Contains(symbol) {
+				a.report(p, p.SymbolColumn(), symbol, "label redefines a predefined symbol")
+				continue
+			}
+			a.labelAt[symbol] = parser.Row{File: p.File(), Line: p.Line()}
+			a.labels[symbol] = romAddr
+			a.symbolTable.AddEntry(symbol, romAddr)
+		}
+	}
+
+	return nil
+}
+
+func (a *Assembler) parse(rows []parser.Row) ([]uint16, []Line, error) {
+	p := parser.NewRows(rows)
+
+	// parse
+	words := []uint16{}
+	lines := []Line{}
+	ramAddr := varBase
+	for p.HasMoreCommands() {
+		// syntax errors have already been reported by scanSymbol
+		ok, err := a.advance(p, false)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !ok {
+			continue
+		}
+
+		line := Line{File: p.File(), Number: p.Line(), Text: p.Text(), Kind: Blank, Addr: len(words)}
+		switch p.CommandType() {
+		case parser.A_CMD, parser.C_CMD:
+			line.Kind = Instruction
+		case parser.L_CMD:
+			line.Kind = Label
+		}
+		// the last Advance only tells EOF
+		if p.HasMoreCommands() {
+			lines = append(lines, line)
+		}
+
+		if line.Kind == Instruction && len(words) == ROMSize {
+			a.report(p, 1, p.Text(), fmt.Sprintf("ROM overflows, the program exceeds %d words", ROMSize))
+		}
+
+		switch p.CommandType() {
+		case parser.A_CMD:
+			symbol := p.Symbol()
+			var addr int
+			if isConst(symbol) {
+				addr, err = strconv.Atoi(symbol)
+				if err != nil || addr > hack.MaxValue {
+					a.report(p, p.SymbolColumn(), symbol, "constant out of range", fmt.Sprintf("0..%d", hack.MaxValue))
+					continue
+				}
+			} else if a.symbolTable.Contains(symbol) {
+				addr = a.symbolTable.GetAddress(symbol)
+				if _, ok := a.labels[symbol]; ok && a.relocatable {
+					a.relocs = append(a.relocs, Reloc{Address: len(words)})
+				}
+			} else if a.relocatable {
+				a.relocs = append(a.relocs, Reloc{Address: len(words), Symbol: symbol})
+			} else {
+				if msg, isErr := variableProblem(symbol, ramAddr); msg != "" {
+					if isErr {
+						a.report(p, p.SymbolColumn(), symbol, msg)
+					} else {
+						a.warn(p, p.SymbolColumn(), symbol, msg)
+					}
+				}
+				a.symbolTable.AddEntry(symbol, ramAddr)
+				a.variables[symbol] = ramAddr
+				addr = ramAddr
+				ramAddr += 1
+			}
+			words = append(words, uint16(addr))
+		case parser.C_CMD:
+			ok := a.checkComp(p)
+			ok = a.checkDest(p) && ok
+			if code.Jump(p.Jump()) == nil {
+				a.report(p, p.JumpColumn(), p.Jump(), "unknown jump mnemonic", code.JumpMnemonics()...)
+				ok = false
+			}
+			if !ok {
+				// keep the addresses of the following commands
+				words = append(words, 0)
+				continue
+			}
+			inst, _ := p.Instruction()
+			w, err := inst.Encode()
+			if err != nil {
+				return nil, nil, err
+			}
+			words = append(words, w)
+		case parser.L_CMD:
+			// do nothing
+		}
+	}
+
+	return words, lines, nil
+}
+
+// variableProblem returns a message if a variable allocated at addr overlaps the memory used for other purposes.
+// It is an error if the variable collides with the memory maps of the I/O devices.
+// Only the first variable of each area is reported, because variables are allocated in order.
+func variableProblem(symbol string, addr int) (msg string, isErr bool) {
+	switch addr {
+	case stackBase:
+		return fmt.Sprintf("variable %s is allocated at RAM %d, where the VM stack starts", symbol, addr), false
+	case screenBase:
+		return fmt.Sprintf("variable %s is allocated at RAM %d, which collides with SCREEN", symbol, addr), true
+	case kbdAddr:
+		return fmt.Sprintf("variable %s is allocated at RAM %d, which collides with KBD", symbol, addr), true
+	}
+	return "", false
+}
+
+// checkComp reports whether comp of the current command can be encoded.
+// Swapped operands such as A+D are accepted unless the assembler is strict.
+func (a *Assembler) checkComp(p *parser.Parser) bool {
+	mnemonic, ok := code.CanonicalComp(p.Comp())
+	if !ok {
+		a.report(p, p.CompColumn(), p.Comp(), "unknown comp mnemonic", code.CompMnemonics()...)
+		return false
+	}
+	if a.Strict && mnemonic != p.Comp() {
+		a.report(p, p.CompColumn(), p.Comp(), "non-canonical comp mnemonic", mnemonic)
+		return false
+	}
+	return true
+}
+
+// checkDest reports whether dest of the current command can be encoded.
+// Registers in any order such as DM are accepted unless the assembler is strict.
+func (a *Assembler) checkDest(p *parser.Parser) bool {
+	mnemonic, ok := code.CanonicalDest(p.Dest())
+	if !ok {
+		a.report(p, p.DestColumn(), p.Dest(), "unknown dest mnemonic", code.DestMnemonics()...)
+		return false
+	}
+	if a.Strict && mnemonic != p.Dest() {
+		a.report(p, p.DestColumn(), p.Dest(), "non-canonical dest mnemonic", mnemonic)
+		return false
+	}
+	return true
+}
+
+// position formats the position of a row for messages about the current command.
+func position(p *parser.Parser, at parser.Row) string {
+	if at.File == p.File() {
+		return fmt.Sprintf("line %d", at.Line)
+	}
+	return fmt.Sprintf("%s:%d", at.File, at.Line)
+}
+
+// nameColumn returns the 1-based column of the name in the directive row text,
+// or the column of the directive if the name is substituted by .define.
+func nameColumn(text, name string) int {
+	isSep := func(c byte) bool {
+		return c == ' ' || c == '\t' || c == ','
+	}
+	for i := 0; i < len(text); {
+		j := strings.Index(text[i:], name)
+		if j < 0 {
+			break
+		}
+		start, end := i+j, i+j+len(name)
+		if (start == 0 || isSep(text[start-1])) && (end == len(text) || isSep(text[end])) {
+			return start + 1
+		}
+		i = end
+	}
+	return len(text) - len(strings.TrimLeft(text, " \t")) + 1
+}
+
+// isConst reports whether the symbol of an A command is a decimal constant.
+func isConst(symbol string) bool {
+	for _, c := range symbol {
+		if c < '0' || '9' < c {
+			return false
+		}
+	}
+	return len(symbol) > 0
+}
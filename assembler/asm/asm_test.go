@@ -0,0 +1,189 @@
+package asm
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// TestAssembleError checks the position and the message of the diagnostics of invalid sources.
+func TestAssembleError(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{
+			name: "bad comp",
+			src:  "@1\nD=X+1\n",
+			want: []string{`A.asm:2:3: unknown comp mnemonic: "X+1"`},
+		},
+		{
+			name: "bad dest",
+			src:  "  X=M\n",
+			want: []string{`A.asm:1:3: unknown dest mnemonic: "X"`},
+		},
+		{
+			name: "bad jump",
+			src:  "0;JMPX\n",
+			want: []string{`A.asm:1:3: unknown jump mnemonic: "JMPX"`},
+		},
+		{
+			name: "duplicate label",
+			src:  "(LOOP)\n@LOOP\n0;JMP\n (LOOP)\n",
+			want: []string{`A.asm:4:3: duplicate label, first defined at line 1: "LOOP"`},
+		},
+		{
+			name: "predefined label",
+			src:  "(SP)\n",
+			want: []string{`A.asm:1:2: label redefines a predefined symbol: "SP"`},
+		},
+		{
+			name: "constant out of range",
+			src:  "@32768\n",
+			want: []string{`A.asm:1:2: constant out of range: "32768" (expected 0..32767)`},
+		},
+		{
+			name: "invalid A command",
+			src:  "@foo-bar\n",
+			want: []string{`A.asm:1:1: invalid A command: "@foo-bar" (expected @value, @symbol)`},
+		},
+		{
+			name: "invalid L command",
+			src:  "(LOOP\n",
+			want: []string{`A.asm:1:1: invalid L command: "(LOOP" (expected (symbol))`},
+		},
+		{
+			name: "undefined global label",
+			src:  "(F)\n  .global FF, F, G // exports\n",
+			want: []string{
+				`A.asm:2:11: global label is not defined: "FF"`,
+				`A.asm:2:18: global label is not defined: "G"`,
+			},
+		},
+		{
+			name: "multiple errors",
+			src:  "(END)\n@END\nD=X\n@99999\n(END)\nM=M+2;JMP\n",
+			want: []string{
+				`A.asm:3:3: unknown comp mnemonic: "X"`,
+				`A.asm:4:2: constant out of range: "99999" (expected 0..32767)`,
+				`A.asm:5:2: duplicate label, first defined at line 1: "END"`,
+				`A.asm:6:3: unknown comp mnemonic: "M+2"`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New("A.asm").Assemble(strings.NewReader(tt.src))
+			var diags DiagnosticList
+			if !errors.As(err, &diags) {
+				t.Fatalf("Assemble() = %v, want a DiagnosticList", err)
+			}
+			if len(diags) != len(tt.want) {
+				t.Fatalf("Assemble() reported %d diagnostics, want %d:\n%v", len(diags), len(tt.want), err)
+			}
+			for i, d := range diags {
+				// the expected mnemonics of comp, dest and jump are long, so only the head is compared
+				if got := d.Error(); !strings.HasPrefix(got, tt.want[i]) {
+					t.Errorf("diagnostic %d = %s, want %s", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+// TestStrict checks that the alternative spellings are assembled as their canonical forms by default,
+// and rejected in strict mode.
+func TestStrict(t *testing.T) {
+	tests := []struct {
+		src       string
+		canonical string
+		want      string
+	}{
+		{src: "D=1+A", canonical: "D=A+1", want: `A.asm:1:3: non-canonical comp mnemonic: "1+A" (expected A+1)`},
+		{src: "D=A+D", canonical: "D=D+A", want: `A.asm:1:3: non-canonical comp mnemonic: "A+D" (expected D+A)`},
+		{src: "M=M&D", canonical: "M=D&M", want: `A.asm:1:3: non-canonical comp mnemonic: "M&D" (expected D&M)`},
+		{src: "DM=M+1", canonical: "MD=M+1", want: `A.asm:1:1: non-canonical dest mnemonic: "DM" (expected MD)`},
+		{src: "MA=0", canonical: "AM=0", want: `A.asm:1:1: non-canonical dest mnemonic: "MA" (expected AM)`},
+		{src: "DAM=-1", canonical: "AMD=-1", want: `A.asm:1:1: non-canonical dest mnemonic: "DAM" (expected AMD)`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			got, err := Assemble(strings.NewReader(tt.src))
+			if err != nil {
+				t.Fatalf("Assemble() = %v", err)
+			}
+			want, err := Assemble(strings.NewReader(tt.canonical))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Words[0] != want.Words[0] {
+				t.Errorf("%s = %016b, want %016b (%s)", tt.src, got.Words[0], want.Words[0], tt.canonical)
+			}
+
+			a := New("A.asm")
+			a.Strict = true
+			_, err = a.Assemble(strings.NewReader(tt.src))
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("strict Assemble() = %v, want %s", err, tt.want)
+			}
+			if _, err := a.Assemble(strings.NewReader(tt.canonical)); err != nil {
+				t.Errorf("strict Assemble(%s) = %v", tt.canonical, err)
+			}
+		})
+	}
+}
+
+// variables returns a source which allocates n variables from RAM 16.
+func variables(n int) string {
+	var sb strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&sb, "@v%d\n", i)
+	}
+	return sb.String()
+}
+
+func TestLimits(t *testing.T) {
+	// v240 is allocated at RAM 256
+	prog, err := New("A.asm").Assemble(strings.NewReader(variables(241)))
+	if err != nil {
+		t.Fatalf("Assemble() = %v", err)
+	}
+	want := `A.asm:241:2: variable v240 is allocated at RAM 256, where the VM stack starts: "v240"`
+	if len(prog.Warnings) != 1 || prog.Warnings[0].Error() != want {
+		t.Errorf("Warnings = %v, want %s", prog.Warnings, want)
+	}
+	if _, err := New("A.asm").Assemble(strings.NewReader(variables(240))); err != nil {
+		t.Errorf("Assemble() of 240 variables = %v", err)
+	}
+
+	// v16368 is allocated at SCREEN, and v24560 at KBD
+	_, err = New("A.asm").Assemble(strings.NewReader(variables(24561)))
+	wantErrs := []string{
+		`A.asm:16369:2: variable v16368 is allocated at RAM 16384, which collides with SCREEN: "v16368"`,
+		`A.asm:24561:2: variable v24560 is allocated at RAM 24576, which collides with KBD: "v24560"`,
+	}
+	var diags DiagnosticList
+	if !errors.As(err, &diags) || len(diags) != len(wantErrs) {
+		t.Fatalf("Assemble() = %v, want %d diagnostics", err, len(wantErrs))
+	}
+	for i, d := range diags {
+		if d.Error() != wantErrs[i] {
+			t.Errorf("diagnostic %d = %s, want %s", i, d.Error(), wantErrs[i])
+		}
+	}
+
+	// the ROM holds 32768 words
+	src := strings.Repeat("D=0\n", ROMSize)
+	if _, err := New("A.asm").Assemble(strings.NewReader(src)); err != nil {
+		t.Errorf("Assemble() of %d words = %v", ROMSize, err)
+	}
+	_, err = New("A.asm").Assemble(strings.NewReader(src + "(END)\n@END\n"))
+	want = `A.asm:32770:1: ROM overflows, the program exceeds 32768 words: "@END"`
+	if err == nil || err.Error() != want {
+		t.Errorf("Assemble() of %d words = %v, want %s", ROMSize+1, err, want)
+	}
+}
@@ -0,0 +1,172 @@
+package asm
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/uu64/nand2tetris/assembler/hack"
+)
+
+// ReadHack reads a hack file, which has a 16-digit binary number on each line.
+func ReadHack(r io.Reader) ([]uint16, error) {
+	words := []uint16{}
+	s := bufio.NewScanner(r)
+	line := 0
+	for s.Scan() {
+		line += 1
+		b := bytes.TrimSpace(s.Bytes())
+		if len(b) == 0 {
+			continue
+		}
+		if len(b) != 16 {
+			return nil, fmt.Errorf("ReadHack: line %d: invalid word %q", line, b)
+		}
+		w, err := strconv.ParseUint(string(b), 2, 16)
+		if err != nil {
+			return nil, fmt.Errorf("ReadHack: line %d: invalid word %q", line, b)
+		}
+		words = append(words, uint16(w))
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return words, nil
+}
+
+func decode(addr int, w uint16) (hack.Instruction, error) {
+	inst, err := hack.Decode(w)
+	if err != nil {
+		return hack.Instruction{}, fmt.Errorf("decode: invalid instruction %016b at %d", w, addr)
+	}
+	return inst, nil
+}
+
+// Disassemble writes the asm source of the words to w.
+// Jump targets get labels such as L10 unless labels names them, and
+// variables restores the names of RAM addresses accessed through M.
+// The prefix of the synthesized labels is extended as L_10 if it collides with a name of the maps.
+// A name is used only if assembling the output gives the same words. Both maps may be nil.
+func Disassemble(w io.Writer, words []uint16, labels, variables map[string]int) error {
+	insts := make([]hack.Instruction, len(words))
+	for i, word := range words {
+		inst, err := decode(i, word)
+		if err != nil {
+			return err
+		}
+		insts[i] = inst
+	}
+
+	// names of the labels defined at each address
+	labelNames := map[int][]string{}
+	for name, addr := range labels {
+		if 0 <= addr && addr <= len(words) {
+			labelNames[addr] = append(labelNames[addr], name)
+		}
+	}
+	for _, names := range labelNames {
+		sort.Strings(names)
+	}
+
+	// synthesize labels for jump targets
+	prefix := labelPrefix(labels, variables)
+	targets := map[int]bool{}
+	for i := 1; i < len(insts); i++ {
+		prev := insts[i-1]
+		if jumps(insts[i]) && prev.Kind == hack.A && prev.Value <= len(words) {
+			targets[prev.Value] = true
+			if len(labelNames[prev.Value]) == 0 {
+				labelNames[prev.Value] = []string{fmt.Sprintf("%s%d", prefix, prev.Value)}
+			}
+		}
+	}
+
+	varNames := map[int]string{}
+	for name, addr := range variables {
+		if _, ok := labels[name]; !ok {
+			if prev, ok := varNames[addr]; !ok || name < prev {
+				varNames[addr] = name
+			}
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	writeLabels := func(addr int) {
+		for _, name := range labelNames[addr] {
+			fmt.Fprintf(bw, "(%s)\n", name)
+		}
+	}
+
+	// variables are allocated from 16 in order of appearance, so a name is used
+	// only when it appears in the same order as its address
+	used := map[string]bool{}
+	ramAddr := 16
+	for i, inst := range insts {
+		writeLabels(i)
+		if inst.Kind != hack.A {
+			fmt.Fprintf(bw, "%s\n", inst)
+			continue
+		}
+
+		next := i+1 < len(insts)
+		symbol := strconv.Itoa(inst.Value)
+		if next && targets[inst.Value] && jumps(insts[i+1]) {
+			symbol = labelNames[inst.Value][0]
+		} else if name, ok := varNames[inst.Value]; ok && next && insts[i+1].UsesM() {
+			if used[name] {
+				symbol = name
+			} else if inst.Value == ramAddr {
+				used[name] = true
+				ramAddr += 1
+				symbol = name
+			}
+		}
+		fmt.Fprintf(bw, "@%s\n", symbol)
+	}
+	writeLabels(len(insts))
+
+	return bw.Flush()
+}
+
+// jumps reports whether the instruction is a C instruction which may jump.
+func jumps(inst hack.Instruction) bool {
+	return inst.Kind == hack.C && inst.Jump != "null"
+}
+
+// labelPrefix returns the prefix of synthesized labels, which is L followed by underscores
+// so that no name of the maps is the prefix followed by digits.
+func labelPrefix(maps ...map[string]int) string {
+	prefix := "L"
+	for collides(prefix, maps) {
+		prefix += "_"
+	}
+	return prefix
+}
+
+func collides(prefix string, maps []map[string]int) bool {
+	for _, m := range maps {
+		for name := range m {
+			if isNumbered(name, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isNumbered reports whether name is prefix followed by one or more digits.
+func isNumbered(name, prefix string) bool {
+	if len(name) <= len(prefix) || !strings.HasPrefix(name, prefix) {
+		return false
+	}
+	for _, c := range name[len(prefix):] {
+		if c < '0' || '9' < c {
+			return false
+		}
+	}
+	return true
+}
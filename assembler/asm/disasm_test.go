@@ -0,0 +1,44 @@
+package asm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// TestDisassembleLabelPrefix checks that a synthesized label does not collide with a variable named like L2.
+func TestDisassembleLabelPrefix(t *testing.T) {
+	prog, err := Assemble(strings.NewReader("@2\n0;JMP\n@L2\nM=0\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := Disassemble(&buf, prog.Words, nil, prog.Variables); err != nil {
+		t.Fatal(err)
+	}
+	want := "@L_2\n0;JMP\n(L_2)\n@L2\nM=0\n"
+	if buf.String() != want {
+		t.Errorf("Disassemble() =\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	again, err := Assemble(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalWords(again.Words, prog.Words) {
+		t.Errorf("reassembled words = %v, want %v", again.Words, prog.Words)
+	}
+}
+
+func equalWords(a, b []uint16) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
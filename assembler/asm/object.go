@@ -0,0 +1,184 @@
+package asm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/uu64/nand2tetris/assembler/internal/diag"
+	"github.com/uu64/nand2tetris/assembler/internal/symboltable"
+)
+
+// Reloc is an A instruction of an object whose value is fixed by the linker.
+// If Symbol is empty, the value is a ROM address in the object and the base address of the object is added.
+// Otherwise the value is the address of Symbol, which is a label of another object or a variable.
+type Reloc struct {
+	Address int    `json:"address"`
+	Symbol  string `json:"symbol,omitempty"`
+}
+
+// Export is a global label defined by an object with its ROM address in the object.
+type Export struct {
+	Name    string `json:"name"`
+	Address int    `json:"address"`
+}
+
+// Object is a separately assembled module, which is linked into a Program.
+// Imports holds the symbols the object uses but does not define, in order of appearance.
+type Object struct {
+	Name    string   `json:"name"`
+	Words   []uint16 `json:"words"`
+	Exports []Export `json:"exports"`
+	Imports []string `json:"imports"`
+	Relocs  []Reloc  `json:"relocs"`
+}
+
+// AssembleObject assembles the asm source read from r into a relocatable object.
+// Only the labels declared by .global are exported, and the other labels are local to the object.
+// The symbols which are not defined in the source are resolved by Link.
+func (a *Assembler) AssembleObject(r io.Reader) (*Object, error) {
+	a.relocatable = true
+	defer func() {
+		a.relocatable = false
+	}()
+
+	prog, err := a.Assemble(r)
+	if err != nil {
+		return nil, err
+	}
+
+	obj := &Object{
+		Name:    strings.TrimSuffix(filepath.Base(a.name), filepath.Ext(a.name)),
+		Words:   prog.Words,
+		Exports: []Export{},
+		Imports: []string{},
+		Relocs:  a.relocs,
+	}
+	if obj.Relocs == nil {
+		obj.Relocs = []Reloc{}
+	}
+	for name := range a.globals {
+		obj.Exports = append(obj.Exports, Export{name, prog.Labels[name]})
+	}
+	sort.Slice(obj.Exports, func(i, j int) bool {
+		if obj.Exports[i].Address != obj.Exports[j].Address {
+			return obj.Exports[i].Address < obj.Exports[j].Address
+		}
+		return obj.Exports[i].Name < obj.Exports[j].Name
+	})
+	seen := map[string]bool{}
+	for _, r := range a.relocs {
+		if r.Symbol != "" && !seen[r.Symbol] {
+			seen[r.Symbol] = true
+			obj.Imports = append(obj.Imports, r.Symbol)
+		}
+	}
+	return obj, nil
+}
+
+// ReadObject reads an object written by WriteObject.
+func ReadObject(r io.Reader) (*Object, error) {
+	var obj Object
+	if err := json.NewDecoder(r).Decode(&obj); err != nil {
+		return nil, fmt.Errorf("ReadObject: %w", err)
+	}
+	return &obj, nil
+}
+
+// WriteObject writes the object as JSON.
+func WriteObject(w io.Writer, obj *Object) error {
+	return json.NewEncoder(w).Encode(obj)
+}
+
+// Link merges the objects in order into a program.
+// Labels are resolved across the objects, and the other symbols are variables
+// allocated from RAM 16 in order of appearance, as Assemble does for a single source.
+// If the objects have problems, the returned error is a DiagnosticList.
+func Link(objs []*Object) (*Program, error) {
+	var diags diag.List
+	st := symboltable.New()
+	labels := map[string]int{}
+	definedBy := map[string]string{}
+
+	// place the objects and collect the exported labels
+	bases := make([]int, len(objs))
+	size := 0
+	for i, obj := range objs {
+		bases[i] = size
+		size += len(obj.Words)
+		for _, e := range obj.Exports {
+			if prev, ok := definedBy[e.Name]; ok {
+				diags = append(diags, &diag.Diagnostic{
+					File:    obj.Name,
+					Text:    e.Name,
+					Message: fmt.Sprintf("duplicate label, also defined in %s", prev),
+				})
+				continue
+			}
+			definedBy[e.Name] = obj.Name
+			labels[e.Name] = bases[i] + e.Address
+			st.AddEntry(e.Name, bases[i]+e.Address)
+		}
+	}
+	if err := diags.Err(); err != nil {
+		return nil, err
+	}
+
+	if size > ROMSize {
+		diags = append(diags, &diag.Diagnostic{
+			Message: fmt.Sprintf("ROM overflows, the program has %d words but the ROM has %d", size, ROMSize),
+		})
+		return nil, diags
+	}
+
+	// relocate
+	words := make([]uint16, 0, size)
+	variables := map[string]int{}
+	var warnings diag.List
+	ramAddr := varBase
+	for i, obj := range objs {
+		code := append([]uint16{}, obj.Words...)
+		for _, r := range obj.Relocs {
+			if r.Address < 0 || r.Address >= len(code) {
+				diags = append(diags, &diag.Diagnostic{
+					File:    obj.Name,
+					Message: fmt.Sprintf("relocation out of range: %d", r.Address),
+				})
+				continue
+			}
+			if r.Symbol == "" {
+				code[r.Address] += uint16(bases[i])
+				continue
+			}
+			if !st.Contains(r.Symbol) {
+				if msg, isErr := variableProblem(r.Symbol, ramAddr); msg != "" {
+					d := &diag.Diagnostic{File: obj.Name, Message: msg}
+					if isErr {
+						diags = append(diags, d)
+					} else {
+						warnings = append(warnings, d)
+					}
+				}
+				st.AddEntry(r.Symbol, ramAddr)
+				variables[r.Symbol] = ramAddr
+				ramAddr += 1
+			}
+			code[r.Address] = uint16(st.GetAddress(r.Symbol))
+		}
+		words = append(words, code...)
+	}
+	if err := diags.Err(); err != nil {
+		return nil, err
+	}
+
+	return &Program{
+		Words:       words,
+		Labels:      labels,
+		Variables:   variables,
+		Warnings:    warnings,
+		symbolTable: st,
+	}, nil
+}
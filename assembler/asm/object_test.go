@@ -0,0 +1,103 @@
+package asm
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const (
+	// linkMain calls Lib.clear, which returns to the address in R15.
+	linkMain = `@RET
+D=A
+@R15
+M=D
+@Lib.clear
+0;JMP
+(RET)
+@i
+D=M
+(LOOP)
+@LOOP
+0;JMP
+`
+	// linkLib counts i up to 10 in a loop with the same label as linkMain.
+	linkLib = `.global Lib.clear
+(Lib.clear)
+@i
+M=0
+(LOOP)
+@i
+M=M+1
+D=M
+@10
+D=D-A
+@LOOP
+D;JLT
+@R15
+A=M
+0;JMP
+`
+)
+
+func assembleObject(t *testing.T, name, src string) *Object {
+	t.Helper()
+	obj, err := New(name).AssembleObject(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("AssembleObject(%s) = %v", name, err)
+	}
+	return obj
+}
+
+// TestLink links two objects which share a local label, and compares the program with the single source.
+func TestLink(t *testing.T) {
+	main := assembleObject(t, "Main.asm", linkMain)
+	lib := assembleObject(t, "Lib.asm", linkLib)
+	if len(main.Exports) != 0 {
+		t.Errorf("Main exports %v, want none", main.Exports)
+	}
+	if len(lib.Exports) != 1 || lib.Exports[0] != (Export{"Lib.clear", 0}) {
+		t.Errorf("Lib exports %v, want [{Lib.clear 0}]", lib.Exports)
+	}
+
+	linked, err := Link([]*Object{main, lib})
+	if err != nil {
+		t.Fatalf("Link() = %v", err)
+	}
+
+	// a single source needs another name for the loop of the library
+	src := linkMain + strings.ReplaceAll(linkLib, "LOOP", "CLEAR_LOOP")
+	want, err := Assemble(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("Assemble() = %v", err)
+	}
+	if len(linked.Words) != len(want.Words) {
+		t.Fatalf("Link() has %d words, want %d", len(linked.Words), len(want.Words))
+	}
+	for i := range want.Words {
+		if linked.Words[i] != want.Words[i] {
+			t.Errorf("word %d = %016b, want %016b", i, linked.Words[i], want.Words[i])
+		}
+	}
+	if linked.Labels["Lib.clear"] != 10 || linked.Variables["i"] != 16 {
+		t.Errorf("Labels = %v, Variables = %v", linked.Labels, linked.Variables)
+	}
+}
+
+func TestLinkDuplicateGlobal(t *testing.T) {
+	a := assembleObject(t, "A.asm", ".global F\n(F)\n@F\n0;JMP\n")
+	b := assembleObject(t, "B.asm", ".global F\n(F)\n@F\n0;JMP\n")
+	_, err := Link([]*Object{a, b})
+	var diags DiagnosticList
+	if !errors.As(err, &diags) || len(diags) != 1 || !strings.Contains(diags[0].Message, "duplicate label") {
+		t.Errorf("Link() = %v, want a duplicate label", err)
+	}
+}
+
+func TestUndefinedGlobal(t *testing.T) {
+	_, err := New("A.asm").AssembleObject(strings.NewReader(".global F\n(G)\n@G\n0;JMP\n"))
+	var diags DiagnosticList
+	if !errors.As(err, &diags) || len(diags) != 1 || diags[0].Line != 1 || diags[0].Message != "global label is not defined" {
+		t.Errorf("AssembleObject() = %v, want an undefined global label at line 1", err)
+	}
+}
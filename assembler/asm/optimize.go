@@ -0,0 +1,249 @@
+package asm
+
+import (
+	"github.com/uu64/nand2tetris/assembler/hack"
+	"github.com/uu64/nand2tetris/assembler/internal/code"
+	"github.com/uu64/nand2tetris/assembler/internal/parser"
+)
+
+// stmt is a command of the instruction stream which the optimizer works on.
+type stmt struct {
+	row parser.Row
+	hack.Instruction
+}
+
+func (s stmt) isA() bool {
+	return s.Kind == hack.A
+}
+
+// setsA reports whether the C command overwrites the A register.
+func (s stmt) setsA() bool {
+	return s.Kind == hack.C && (s.Dest == "A" || s.Dest == "AM" || s.Dest == "AD" || s.Dest == "AMD")
+}
+
+// jumps reports whether the C command may jump.
+func (s stmt) jumps() bool {
+	return s.Kind == hack.C && s.Jump != "null"
+}
+
+// jumpsAlways reports whether the C command jumps unconditionally.
+func (s stmt) jumpsAlways() bool {
+	if s.Kind != hack.C {
+		return false
+	}
+	switch s.Jump {
+	case "JMP":
+		return true
+	case "JEQ", "JGE", "JLE":
+		return s.Comp == "0"
+	case "JNE", "JLT":
+		return s.Comp == "-1"
+	case "JGT":
+		return s.Comp == "1"
+	}
+	return false
+}
+
+// optimize applies peephole optimizations to the rows and returns the optimized rows
+// with the number of ROM words saved. The global labels are kept even if they are not used,
+// because an object exports them to other objects.
+//
+// It assumes that ROM addresses are referenced only by labels, so rows which use a constant
+// as a jump target are returned as they are with ok false.
+// Rows which have syntax errors are returned as they are with ok true, because the assembler reports the errors.
+func optimize(rows []parser.Row, globals map[string]parser.Row) (optimized []parser.Row, saved int, ok bool) {
+	stmts, valid := stream(rows)
+	if !valid {
+		return rows, 0, true
+	}
+	if hardcoded(stmts) {
+		return rows, 0, false
+	}
+
+	passes := []func([]stmt) ([]stmt, bool){
+		func(stmts []stmt) ([]stmt, bool) {
+			return dropUnusedLabels(stmts, globals)
+		},
+		dropUnreachable,
+		dropReloads,
+		foldIncDec,
+		cancelPushPop,
+	}
+
+	before := countWords(stmts)
+	for changed := true; changed; {
+		changed = false
+		for _, pass := range passes {
+			var c bool
+			stmts, c = pass(stmts)
+			changed = changed || c
+		}
+	}
+
+	optimized = make([]parser.Row, len(stmts))
+	for i, s := range stmts {
+		optimized[i] = parser.Row{File: s.row.File, Line: s.row.Line, Text: s.String()}
+	}
+	return optimized, before - countWords(stmts), true
+}
+
+// stream parses the rows into commands. Comments and empty rows are dropped.
+// It returns false if the rows have syntax errors.
+func stream(rows []parser.Row) ([]stmt, bool) {
+	p := parser.NewRows(rows)
+	stmts := []stmt{}
+	for p.HasMoreCommands() {
+		if err := p.Advance(); err != nil {
+			return nil, false
+		}
+
+		inst, ok := p.Instruction()
+		if !ok {
+			continue
+		}
+		s := stmt{row: parser.Row{File: p.File(), Line: p.Line()}, Instruction: inst}
+		if s.Kind == hack.C {
+			if canonical, ok := code.CanonicalDest(s.Dest); ok {
+				s.Dest = canonical
+			}
+			if canonical, ok := code.CanonicalComp(s.Comp); ok {
+				s.Comp = canonical
+			}
+		}
+		stmts = append(stmts, s)
+	}
+	return stmts, true
+}
+
+// hardcoded reports whether a constant is used as a jump target, which means that ROM addresses are hard-coded.
+func hardcoded(stmts []stmt) bool {
+	for i := 1; i < len(stmts); i++ {
+		if stmts[i].jumps() && stmts[i-1].isA() && isConst(stmts[i-1].Symbol) {
+			return true
+		}
+	}
+	return false
+}
+
+func countWords(stmts []stmt) int {
+	n := 0
+	for _, s := range stmts {
+		if s.Kind != hack.Label {
+			n += 1
+		}
+	}
+	return n
+}
+
+// dropUnusedLabels removes the labels which no A command refers to, except the global labels.
+func dropUnusedLabels(stmts []stmt, globals map[string]parser.Row) ([]stmt, bool) {
+	used := map[string]bool{}
+	for _, s := range stmts {
+		if s.isA() {
+			used[s.Symbol] = true
+		}
+	}
+
+	out := stmts[:0]
+	for _, s := range stmts {
+		if _, global := globals[s.Symbol]; s.Kind == hack.Label && !used[s.Symbol] && !global {
+			continue
+		}
+		out = append(out, s)
+	}
+	return out, len(out) != len(stmts)
+}
+
+// dropUnreachable removes the commands between an unconditional jump and the next label.
+func dropUnreachable(stmts []stmt) ([]stmt, bool) {
+	out := stmts[:0]
+	n := len(stmts)
+	reachable := true
+	for _, s := range stmts {
+		if s.Kind == hack.Label {
+			reachable = true
+		}
+		if reachable {
+			out = append(out, s)
+		}
+		if s.jumpsAlways() {
+			reachable = false
+		}
+	}
+	return out, len(out) != n
+}
+
+// dropReloads removes an A command which loads the value the A register already has.
+func dropReloads(stmts []stmt) ([]stmt, bool) {
+	out := stmts[:0]
+	n := len(stmts)
+	known := ""
+	for _, s := range stmts {
+		switch {
+		case s.Kind == hack.Label:
+			// the value is unknown when it is jumped to
+			known = ""
+		case s.isA():
+			if s.Symbol == known {
+				continue
+			}
+			known = s.Symbol
+		case s.setsA():
+			known = ""
+		}
+		out = append(out, s)
+	}
+	return out, len(out) != n
+}
+
+// foldIncDec replaces M=M+1 followed by AM=M-1, which leaves the memory as it is, with A=M.
+func foldIncDec(stmts []stmt) ([]stmt, bool) {
+	out := []stmt{}
+	changed := false
+	for i := 0; i < len(stmts); i++ {
+		if i+1 < len(stmts) && is(stmts[i], "M=M+1") && is(stmts[i+1], "AM=M-1") {
+			a := stmts[i+1]
+			a.Dest = "A"
+			a.Comp = "M"
+			out = append(out, a)
+			i += 1
+			changed = true
+			continue
+		}
+		out = append(out, stmts[i])
+	}
+	return out, changed
+}
+
+// pushPop is a push of D followed by a pop into D, after foldIncDec and dropReloads.
+var pushPop = []string{"@SP", "A=M", "M=D", "@SP", "A=M", "D=M"}
+
+// cancelPushPop removes a push of D immediately popped into D.
+// The A register is left different, so it is done only if an A command follows.
+func cancelPushPop(stmts []stmt) ([]stmt, bool) {
+	out := []stmt{}
+	changed := false
+	for i := 0; i < len(stmts); i++ {
+		end := i + len(pushPop)
+		if end < len(stmts) && stmts[end].isA() && matches(stmts[i:end], pushPop) {
+			i = end - 1
+			changed = true
+			continue
+		}
+		out = append(out, stmts[i])
+	}
+	return out, changed
+}
+
+func is(s stmt, text string) bool {
+	return s.Kind != hack.Label && s.String() == text
+}
+
+func matches(stmts []stmt, texts []string) bool {
+	for i, text := range texts {
+		if !is(stmts[i], text) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,138 @@
+package asm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/uu64/nand2tetris/assembler/internal/parser"
+)
+
+// rows splits the source into rows.
+func rows(src string) []parser.Row {
+	var rows []parser.Row
+	for i, text := range strings.Split(strings.TrimSpace(src), "\n") {
+		rows = append(rows, parser.Row{File: "test.asm", Line: i + 1, Text: text})
+	}
+	return rows
+}
+
+// texts formats the commands as a source.
+func texts(stmts []stmt) string {
+	var lines []string
+	for _, s := range stmts {
+		lines = append(lines, s.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+type passTest struct {
+	name string
+	src  string
+	// want is the source after the pass, or empty if the pass must not change it
+	want string
+}
+
+func testPass(t *testing.T, pass func([]stmt) ([]stmt, bool), tests []passTest) {
+	t.Helper()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stmts, ok := stream(rows(tt.src))
+			if !ok {
+				t.Fatalf("stream() failed")
+			}
+			src := texts(stmts)
+			want := tt.want
+			if want == "" {
+				want = src
+			}
+
+			got, changed := pass(stmts)
+			if texts(got) != want {
+				t.Errorf("got\n%s\nwant\n%s", texts(got), want)
+			}
+			if changed != (want != src) {
+				t.Errorf("changed = %v, want %v", changed, want != src)
+			}
+		})
+	}
+}
+
+func TestDropUnusedLabels(t *testing.T) {
+	globals := map[string]parser.Row{"Lib.f": {}}
+	testPass(t, func(stmts []stmt) ([]stmt, bool) {
+		return dropUnusedLabels(stmts, globals)
+	}, []passTest{
+		{name: "unused", src: "(A)\n@B\n0;JMP\n(B)\nD=0", want: "@B\n0;JMP\n(B)\nD=0"},
+		// the address of RET is loaded into D and jumped to later through memory
+		{name: "computed jump", src: "@RET\nD=A\n@R15\nM=D\n(RET)\n@R15\nA=M\n0;JMP"},
+		{name: "global", src: "(Lib.f)\nD=0"},
+	})
+}
+
+func TestDropUnreachable(t *testing.T) {
+	testPass(t, dropUnreachable, []passTest{
+		{name: "after jump", src: "@END\n0;JMP\nD=0\n@R0\nM=D\n(END)\nD=1", want: "@END\n0;JMP\n(END)\nD=1"},
+		{name: "JMP", src: "@END\nD;JMP\nD=0\n(END)", want: "@END\nD;JMP\n(END)"},
+		{name: "always taken", src: "@END\n0;JEQ\nD=0\n(END)", want: "@END\n0;JEQ\n(END)"},
+		{name: "conditional", src: "@END\nD;JGT\nD=0\n(END)"},
+		{name: "never taken", src: "@END\n0;JNE\nD=0\n(END)"},
+		// RET is reached by a computed jump, which is a label
+		{name: "computed jump", src: "@R15\nA=M\n0;JMP\n(RET)\nD=0"},
+	})
+}
+
+func TestDropReloads(t *testing.T) {
+	testPass(t, dropReloads, []passTest{
+		{name: "reload", src: "@X\nD=M\n@X\nM=D+1", want: "@X\nD=M\nM=D+1"},
+		// a write to M leaves the A register
+		{name: "after M write", src: "@X\nM=D\n@X\nD=M", want: "@X\nM=D\nD=M"},
+		{name: "after A write", src: "@SP\nAM=M-1\n@SP\nD=M"},
+		{name: "after AMD write", src: "@SP\nAMD=M+1\n@SP\nD=M"},
+		{name: "after A=M", src: "@X\nA=M\n@X\nD=M"},
+		{name: "after label", src: "@X\nD=M\n(L)\n@X\nD=M"},
+		{name: "other symbol", src: "@R0\nD=M\n@SP\nD=M"},
+	})
+}
+
+func TestFoldIncDec(t *testing.T) {
+	testPass(t, foldIncDec, []passTest{
+		{name: "fold", src: "@SP\nM=M+1\nAM=M-1\nD=M", want: "@SP\nA=M\nD=M"},
+		{name: "label between", src: "@SP\nM=M+1\n(L)\nAM=M-1"},
+		{name: "D written", src: "@SP\nMD=M+1\nAM=M-1"},
+		{name: "M decremented", src: "@SP\nM=M+1\nM=M-1"},
+	})
+}
+
+func TestCancelPushPop(t *testing.T) {
+	testPass(t, cancelPushPop, []passTest{
+		{name: "cancel", src: "@SP\nA=M\nM=D\n@SP\nA=M\nD=M\n@X\nM=D", want: "@X\nM=D"},
+		{name: "D used between", src: "@SP\nA=M\nM=D\nD=D+1\n@SP\nA=M\nD=M\n@X\nM=D"},
+		{name: "label between", src: "@SP\nA=M\nM=D\n(L)\n@SP\nA=M\nD=M\n@X\nM=D"},
+		// the A register is used after the pop
+		{name: "A used after", src: "@SP\nA=M\nM=D\n@SP\nA=M\nD=M\nM=0"},
+		{name: "at the end", src: "@SP\nA=M\nM=D\n@SP\nA=M\nD=M"},
+	})
+}
+
+func TestOptimizeSkipped(t *testing.T) {
+	src := rows("@R0\nD=M\n@10\n0;JMP")
+	if got, saved, ok := optimize(src, nil); ok || saved != 0 || len(got) != len(src) {
+		t.Errorf("optimize() of a constant jump target = %d rows, %d saved, %v, want it skipped", len(got), saved, ok)
+	}
+
+	// the syntax error is reported by the assembler, not as a skipped optimization
+	src = rows("@R0\nD=?\n@END\n0;JMP\n(END)")
+	if got, saved, ok := optimize(src, nil); !ok || saved != 0 || len(got) != len(src) {
+		t.Errorf("optimize() of a syntax error = %d rows, %d saved, %v, want the rows as they are", len(got), saved, ok)
+	}
+
+	a := New("test.asm")
+	a.Optimize = true
+	prog, err := a.Assemble(strings.NewReader("@R0\nD=M\n@10\n0;JMP\n"))
+	if err != nil {
+		t.Fatalf("Assemble() = %v", err)
+	}
+	if len(prog.Warnings) != 1 || !strings.Contains(prog.Warnings[0].Message, "optimization is skipped") {
+		t.Errorf("Warnings = %v, want the optimization skipped", prog.Warnings)
+	}
+}
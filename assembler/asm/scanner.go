@@ -0,0 +1,58 @@
+package asm
+
+import (
+	"io"
+
+	"github.com/uu64/nand2tetris/assembler/hack"
+	"github.com/uu64/nand2tetris/assembler/internal/parser"
+)
+
+// Scanner reads the instructions of an asm source one by one.
+// Symbols are not resolved and directives are not expanded.
+//
+//	s := asm.NewScanner(r)
+//	for s.Scan() {
+//		fmt.Println(s.Line(), s.Instruction())
+//	}
+//	if err := s.Err(); err != nil {
+//		log.Fatal(err)
+//	}
+type Scanner struct {
+	p    *parser.Parser
+	inst hack.Instruction
+	err  error
+}
+
+func NewScanner(r io.Reader) *Scanner {
+	return &Scanner{p: parser.New(r)}
+}
+
+// Scan advances to the next instruction, skipping comments and empty lines.
+// It returns false at the end of the source or at the first syntax error.
+func (s *Scanner) Scan() bool {
+	for s.err == nil && s.p.HasMoreCommands() {
+		if s.err = s.p.Advance(); s.err != nil {
+			return false
+		}
+		if inst, ok := s.p.Instruction(); ok {
+			s.inst = inst
+			return true
+		}
+	}
+	return false
+}
+
+// Instruction returns the instruction read by the last Scan.
+func (s *Scanner) Instruction() hack.Instruction {
+	return s.inst
+}
+
+// Line returns the 1-based line number of the instruction read by the last Scan.
+func (s *Scanner) Line() int {
+	return s.p.Line()
+}
+
+// Err returns the first error, which is a *Diagnostic for a syntax error.
+func (s *Scanner) Err() error {
+	return s.err
+}
@@ -5,93 +5,97 @@ import (
 	"bytes"
 	"fmt"
 	"os"
-	"strconv"
+	"path/filepath"
+	"strings"
 
-	"github.com/uu64/nand2tetris/assembler/internal/code"
-	"github.com/uu64/nand2tetris/assembler/internal/parser"
-	"github.com/uu64/nand2tetris/assembler/internal/symboltable"
+	"github.com/uu64/nand2tetris/assembler/asm"
+	"github.com/uu64/nand2tetris/assembler/format"
 )
 
+// Options selects the optional behavior of Cmd.
+type Options struct {
+	// List writes a listing file (.lst).
+	List bool
+	// Sym writes a symbol file (.sym).
+	Sym bool
+	// Strict rejects the alternative spellings of comp and dest.
+	Strict bool
+	// Format is the name of the output format registered in the format package.
+	Format string
+	// Object writes a relocatable object (.hobj) instead of the program.
+	Object bool
+	// Optimize applies peephole optimizations and reports the number of ROM words saved.
+	Optimize bool
+	// Size prints the ROM and RAM usage of the program.
+	Size bool
+}
+
+// ExtObject is the extension of object files.
+const ExtObject = ".hobj"
+
 type Cmd struct {
 	asmfilePath string
-	symbolTable *symboltable.SymbolTable
+	outputPath  string
+	opts        Options
 }
 
-func New(asmfilePath string) *Cmd {
+// New returns a command which assembles asmfilePath into outputPath.
+// If outputPath is empty, the output is written next to the asm file.
+// The listing and symbol files are written next to the output.
+func New(asmfilePath, outputPath string, opts Options) *Cmd {
 	return &Cmd{
 		asmfilePath: asmfilePath,
-		symbolTable: symboltable.New(),
+		outputPath:  outputPath,
+		opts:        opts,
 	}
 }
 
-func (cmd *Cmd) scanSymbol() error {
-	// create parser
-	f, err := os.Open(cmd.asmfilePath)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-	p := parser.New(f)
-
-	// scan
-	romAddr := 0
-	for p.HasMoreCommands() {
-		p.Advance()
-		switch p.CommandType() {
-		case parser.A_CMD, parser.C_CMD:
-			romAddr += 1
-		case parser.L_CMD:
-			cmd.symbolTable.AddEntry(p.Symbol(), romAddr)
-		}
+// path returns the path of the output file with the extension.
+func (cmd *Cmd) path(ext string) string {
+	if cmd.outputPath == "" {
+		return trimExt(cmd.asmfilePath) + ext
 	}
+	return trimExt(cmd.outputPath) + ext
+}
 
-	return nil
+// trimExt removes the extension from the path.
+func trimExt(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path))
 }
 
-func (cmd *Cmd) parse() (*bytes.Buffer, error) {
-	// create parser
+func (cmd *Cmd) assemble() (*asm.Program, error) {
 	f, err := os.Open(cmd.asmfilePath)
 	if err != nil {
 		return nil, err
 	}
 	defer f.Close()
-	p := parser.New(f)
 
-	// parse
-	buf := bytes.NewBuffer([]byte{})
-	ramAddr := 16
-	for p.HasMoreCommands() {
-		p.Advance()
-		switch p.CommandType() {
-		case parser.A_CMD:
-			symbol := p.Symbol()
-			addr, err := strconv.Atoi(symbol)
-			if err != nil {
-				if cmd.symbolTable.Contains(symbol) {
-					addr = cmd.symbolTable.GetAddress(symbol)
-				} else {
-					cmd.symbolTable.AddEntry(symbol, ramAddr)
-					addr = ramAddr
-					ramAddr += 1
-				}
-			}
-			fmt.Fprintf(buf, "%016b\n", addr)
-		case parser.C_CMD:
-			comp := code.Comp(p.Comp())
-			dest := code.Dest(p.Dest())
-			jump := code.Jump(p.Jump())
-			fmt.Fprintf(buf, "111%07s%03s%03s\n", comp, dest, jump)
-		case parser.L_CMD:
-			// do nothing
-		}
+	a := asm.New(cmd.asmfilePath)
+	a.Strict = cmd.opts.Strict
+	a.Optimize = cmd.opts.Optimize
+	prog, err := a.Assemble(f)
+	if err != nil {
+		return nil, err
 	}
 
-	return buf, nil
+	for _, w := range prog.Warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", w)
+	}
+	if cmd.opts.Optimize {
+		fmt.Printf("%s: saved %d ROM words\n", cmd.asmfilePath, prog.Saved)
+	}
+	return prog, nil
 }
 
-func (cmd *Cmd) write(b []byte) error {
-	outputPath := fmt.Sprintf("%s.hack", cmd.asmfilePath[0:len(cmd.asmfilePath)-len(".asm")])
+func (cmd *Cmd) encode(prog *asm.Program) (*bytes.Buffer, error) {
+	buf := bytes.NewBuffer([]byte{})
+	if err := format.Encode(buf, cmd.opts.Format, prog.Words); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
 
+func (cmd *Cmd) write(outputPath string, b []byte) error {
 	f, err := os.Create(outputPath)
 	if err != nil {
 		return err
@@ -113,19 +117,83 @@ func (cmd *Cmd) write(b []byte) error {
 	return nil
 }
 
+func (cmd *Cmd) assembleObject() (*asm.Object, error) {
+	f, err := os.Open(cmd.asmfilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	a := asm.New(cmd.asmfilePath)
+	a.Strict = cmd.opts.Strict
+	a.Optimize = cmd.opts.Optimize
+	return a.AssembleObject(f)
+}
+
 func (cmd *Cmd) Run() (err error) {
-	if err = cmd.scanSymbol(); err != nil {
-		return err
+	if cmd.opts.Object {
+		obj, err := cmd.assembleObject()
+		if err != nil {
+			return err
+		}
+
+		buf := bytes.NewBuffer([]byte{})
+		if err = asm.WriteObject(buf, obj); err != nil {
+			return err
+		}
+		outputPath := cmd.outputPath
+		if outputPath == "" {
+			outputPath = cmd.path(ExtObject)
+		}
+		return cmd.write(outputPath, buf.Bytes())
 	}
 
-	buf, err := cmd.parse()
+	prog, err := cmd.assemble()
 	if err != nil {
 		return err
 	}
+	return cmd.output(prog)
+}
 
-	err = cmd.write(buf.Bytes())
+// output writes the program in the format, and the listing and symbol files if they are enabled.
+func (cmd *Cmd) output(prog *asm.Program) (err error) {
+	f, ok := format.Lookup(cmd.opts.Format)
+	if !ok {
+		return fmt.Errorf("Run: unknown format: %s", cmd.opts.Format)
+	}
+	buf, err := cmd.encode(prog)
 	if err != nil {
 		return err
 	}
+	outputPath := cmd.outputPath
+	if outputPath == "" {
+		outputPath = cmd.path(f.Ext())
+	}
+	err = cmd.write(outputPath, buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	if cmd.opts.List {
+		err = cmd.write(cmd.path(".lst"), cmd.listing(prog).Bytes())
+		if err != nil {
+			return err
+		}
+	}
+
+	if cmd.opts.Size {
+		fmt.Print(cmd.size(prog))
+	}
+
+	if cmd.opts.Sym {
+		b, err := cmd.symbols(prog)
+		if err != nil {
+			return err
+		}
+		err = cmd.write(cmd.path(".sym"), b)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
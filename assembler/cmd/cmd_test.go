@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/uu64/nand2tetris/assembler/asm"
+	"github.com/uu64/nand2tetris/assembler/hack"
+)
+
+// projects06 is the directory of the asm programs of project 6.
+var projects06 = filepath.Join("..", "..", "projects", "06")
+
+// golden returns the path of the reference hack file of an asm file.
+// A program with and without symbols, such as Max.asm and MaxL.asm, shares the reference.
+func golden(asmfilePath string) string {
+	name := strings.TrimSuffix(filepath.Base(asmfilePath), ".asm")
+	name = strings.TrimSuffix(name, "L")
+	return filepath.Join("testdata", "06", name+".hack")
+}
+
+// TestGolden assembles every asm file of projects/06 and compares the output with the reference word for word.
+func TestGolden(t *testing.T) {
+	var paths []string
+	err := filepath.WalkDir(projects06, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && filepath.Ext(path) == ".asm" {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatalf("no asm files in %s", projects06)
+	}
+
+	for _, path := range paths {
+		path := path
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			t.Parallel()
+
+			want, err := os.ReadFile(golden(path))
+			if err != nil {
+				t.Fatalf("no reference: %v", err)
+			}
+
+			outputPath := filepath.Join(t.TempDir(), "out.hack")
+			if err := New(path, outputPath, Options{Format: "hack"}).Run(); err != nil {
+				t.Fatalf("Run() = %v", err)
+			}
+			got, err := os.ReadFile(outputPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if msg := firstDiff(path, got, want); msg != "" {
+				t.Error(msg)
+			}
+		})
+	}
+}
+
+// firstDiff compares the hack files and reports the first different word
+// with its source line and both instructions, or returns an empty string if they are the same.
+func firstDiff(asmfilePath string, got, want []byte) string {
+	gotWords := fields(got)
+	wantWords := fields(want)
+
+	n := len(gotWords)
+	if len(wantWords) < n {
+		n = len(wantWords)
+	}
+	addr := -1
+	for i := 0; i < n; i++ {
+		if gotWords[i] != wantWords[i] {
+			addr = i
+			break
+		}
+	}
+	if addr < 0 {
+		if len(gotWords) == len(wantWords) {
+			return ""
+		}
+		addr = n
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "first difference at ROM address %d", addr)
+	if line, ok := sourceLine(asmfilePath, addr); ok {
+		fmt.Fprintf(&sb, " (%s:%d: %s)", asmfilePath, line.Number, strings.TrimSpace(line.Text))
+	}
+	fmt.Fprintf(&sb, "\n  got:  %s\n  want: %s", describe(gotWords, addr), describe(wantWords, addr))
+	fmt.Fprintf(&sb, "\n  %d words, want %d words", len(gotWords), len(wantWords))
+	return sb.String()
+}
+
+// fields returns the words of a hack file, ignoring CR and empty lines.
+func fields(b []byte) []string {
+	return strings.Fields(string(bytes.ReplaceAll(b, []byte("\r"), nil)))
+}
+
+// describe formats the word at addr with the instruction it decodes to.
+func describe(words []string, addr int) string {
+	if addr >= len(words) {
+		return "end of file"
+	}
+	var w uint16
+	if _, err := fmt.Sscanf(words[addr], "%b", &w); err != nil {
+		return fmt.Sprintf("%s (not a word)", words[addr])
+	}
+	inst, err := hack.Decode(w)
+	if err != nil {
+		return fmt.Sprintf("%s (invalid instruction)", words[addr])
+	}
+	return fmt.Sprintf("%s (%s)", words[addr], inst)
+}
+
+// sourceLine returns the source line of the instruction at addr.
+func sourceLine(asmfilePath string, addr int) (asm.Line, bool) {
+	f, err := os.Open(asmfilePath)
+	if err != nil {
+		return asm.Line{}, false
+	}
+	defer f.Close()
+
+	prog, err := asm.New(asmfilePath).Assemble(f)
+	if err != nil {
+		return asm.Line{}, false
+	}
+	for _, l := range prog.Lines {
+		if l.Kind == asm.Instruction && l.Addr == addr {
+			return l, true
+		}
+	}
+	return asm.Line{}, false
+}
+
+func TestFirstDiff(t *testing.T) {
+	asmfilePath := filepath.Join(projects06, "add", "Add.asm")
+	want, err := os.ReadFile(golden(asmfilePath))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg := firstDiff(asmfilePath, want, want); msg != "" {
+		t.Errorf("firstDiff() of the same files = %q", msg)
+	}
+
+	// D=M instead of D=A at address 1
+	got := bytes.Replace(want, []byte("1110110000010000"), []byte("1111110000010000"), 1)
+	msg := firstDiff(asmfilePath, got, want)
+	for _, s := range []string{"ROM address 1", "Add.asm:9: D=A", "got:  1111110000010000 (D=M)", "want: 1110110000010000 (D=A)"} {
+		if !strings.Contains(msg, s) {
+			t.Errorf("firstDiff() = %q, want it to contain %q", msg, s)
+		}
+	}
+
+	msg = firstDiff(asmfilePath, want[:len(want)-17], want)
+	if !strings.Contains(msg, "ROM address 5") || !strings.Contains(msg, "got:  end of file") {
+		t.Errorf("firstDiff() of a short file = %q", msg)
+	}
+}
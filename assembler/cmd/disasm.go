@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/uu64/nand2tetris/assembler/asm"
+)
+
+type Disasm struct {
+	hackfilePath string
+	outputPath   string
+	symfilePath  string
+}
+
+// NewDisasm returns a command which disassembles a hack file into outputPath.
+// If outputPath is empty, the output is written next to the hack file as .dis.asm.
+// symfilePath is a symbol file written by -sym to restore names, or empty.
+func NewDisasm(hackfilePath, outputPath, symfilePath string) *Disasm {
+	return &Disasm{
+		hackfilePath: hackfilePath,
+		outputPath:   outputPath,
+		symfilePath:  symfilePath,
+	}
+}
+
+func (cmd *Disasm) readWords() ([]uint16, error) {
+	f, err := os.Open(cmd.hackfilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return asm.ReadHack(f)
+}
+
+func (cmd *Disasm) readSymbols() (labels, variables map[string]int, err error) {
+	if cmd.symfilePath == "" {
+		return nil, nil, nil
+	}
+
+	b, err := os.ReadFile(cmd.symfilePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var sf SymbolFile
+	if err = json.Unmarshal(b, &sf); err != nil {
+		return nil, nil, fmt.Errorf("readSymbols: %s: %w", cmd.symfilePath, err)
+	}
+
+	labels = map[string]int{}
+	for _, s := range sf.Labels {
+		labels[s.Name] = s.Address
+	}
+	variables = map[string]int{}
+	for _, s := range sf.Variables {
+		variables[s.Name] = s.Address
+	}
+	return labels, variables, nil
+}
+
+func (cmd *Disasm) Run() (err error) {
+	words, err := cmd.readWords()
+	if err != nil {
+		return err
+	}
+
+	labels, variables, err := cmd.readSymbols()
+	if err != nil {
+		return err
+	}
+
+	outputPath := cmd.outputPath
+	if outputPath == "" {
+		outputPath = trimExt(cmd.hackfilePath) + ".dis.asm"
+	}
+	f, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	if err = asm.Disassemble(w, words, labels, variables); err != nil {
+		return err
+	}
+	return w.Flush()
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestDisasmRoundTrip disassembles the programs of projects/06 with and without the symbol file,
+// and reassembles the output to compare it with the program word for word.
+func TestDisasmRoundTrip(t *testing.T) {
+	sources := []string{"add/Add.asm", "max/Max.asm", "rect/Rect.asm", "pong/Pong.asm"}
+	for _, src := range sources {
+		for _, names := range []bool{false, true} {
+			src, names := src, names
+			name := filepath.Base(src)
+			if names {
+				name += " with names"
+			}
+			t.Run(name, func(t *testing.T) {
+				t.Parallel()
+				b, err := os.ReadFile(filepath.Join("..", "..", "projects", "06", filepath.FromSlash(src)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				dir := t.TempDir()
+				path := filepath.Join(dir, "prog.asm")
+				if err := os.WriteFile(path, b, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				if err := New(path, "", Options{Format: "hack", Sym: true}).Run(); err != nil {
+					t.Fatalf("Run() = %v", err)
+				}
+
+				hackfilePath := filepath.Join(dir, "prog.hack")
+				symfilePath := ""
+				if names {
+					symfilePath = filepath.Join(dir, "prog.sym")
+				}
+				disasm := NewDisasm(hackfilePath, "", symfilePath)
+				if err := disasm.Run(); err != nil {
+					t.Fatalf("Disasm.Run() = %v", err)
+				}
+
+				// the disassembly is assembled into prog.dis.hack
+				if err := New(filepath.Join(dir, "prog.dis.asm"), "", Options{Format: "hack"}).Run(); err != nil {
+					t.Fatalf("Run() of the disassembly = %v", err)
+				}
+				want, err := os.ReadFile(hackfilePath)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := os.ReadFile(filepath.Join(dir, "prog.dis.hack"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(got) != string(want) {
+					t.Errorf("reassembled program differs from %s", src)
+				}
+
+				if !names {
+					return
+				}
+				dis, err := os.ReadFile(filepath.Join(dir, "prog.dis.asm"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				labels, _, err := disasm.readSymbols()
+				if err != nil {
+					t.Fatal(err)
+				}
+				for label := range labels {
+					if !strings.Contains(string(dis), "("+label+")") {
+						t.Errorf("label %s is not restored", label)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/uu64/nand2tetris/assembler/asm"
+)
+
+type Link struct {
+	objfilePaths []string
+	outputPath   string
+	opts         Options
+}
+
+// NewLink returns a command which links the object files in order into outputPath.
+// A linked program has no source lines, so opts must not enable the listing and the symbol file.
+func NewLink(objfilePaths []string, outputPath string, opts Options) *Link {
+	return &Link{
+		objfilePaths: objfilePaths,
+		outputPath:   outputPath,
+		opts:         opts,
+	}
+}
+
+func readObject(path string) (*asm.Object, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return asm.ReadObject(f)
+}
+
+func (cmd *Link) Run() (err error) {
+	objs := make([]*asm.Object, len(cmd.objfilePaths))
+	for i, path := range cmd.objfilePaths {
+		if objs[i], err = readObject(path); err != nil {
+			return err
+		}
+	}
+
+	prog, err := asm.Link(objs)
+	if err != nil {
+		return err
+	}
+	for _, w := range prog.Warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", w)
+	}
+
+	// a linked program has no source, so the output is written as if it is assembled from itself
+	return New(cmd.outputPath, cmd.outputPath, cmd.opts).output(prog)
+}
@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/uu64/nand2tetris/assembler/asm"
+)
+
+// listing formats the program as a listing which shows ROM addresses,
+// machine code and source lines side by side.
+// Rows from an included file are preceded by the name of the file.
+func (cmd *Cmd) listing(prog *asm.Program) *bytes.Buffer {
+	buf := bytes.NewBuffer([]byte{})
+	fmt.Fprintf(buf, "%5s  %-4s  %-16s  %5s  %s\n", "addr", "hex", "binary", "line", "source")
+	file := cmd.asmfilePath
+	for _, l := range prog.Lines {
+		if l.File != file {
+			file = l.File
+			fmt.Fprintf(buf, "-- %s\n", file)
+		}
+		switch l.Kind {
+		case asm.Instruction:
+			w := prog.Words[l.Addr]
+			fmt.Fprintf(buf, "%5d  %04X  %016b  %5d  %s\n", l.Addr, w, w, l.Number, l.Text)
+		case asm.Label:
+			fmt.Fprintf(buf, "%5d  %-4s  %-16s  %5d  %s\n", l.Addr, "", "", l.Number, l.Text)
+		default:
+			fmt.Fprintf(buf, "%5s  %-4s  %-16s  %5d  %s\n", "", "", "", l.Number, l.Text)
+		}
+	}
+	return buf
+}
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestListing formats the listing of projects/06 Max and compares it with the reference line by line.
+// The reference shows the address and the word of each instruction, the address of each label
+// and the comment lines without an address.
+func TestListing(t *testing.T) {
+	path := filepath.Join("..", "..", "projects", "06", "max", "Max.asm")
+	want, err := os.ReadFile(filepath.Join("testdata", "06", "Max.lst"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := New(path, "", Options{Format: "hack"})
+	prog, err := cmd.assemble()
+	if err != nil {
+		t.Fatalf("assemble() = %v", err)
+	}
+	got := cmd.listing(prog).Bytes()
+
+	gotLines := strings.Split(string(got), "\n")
+	wantLines := strings.Split(string(want), "\n")
+	for i := 0; i < len(gotLines) && i < len(wantLines); i++ {
+		if gotLines[i] != wantLines[i] {
+			t.Fatalf("line %d:\n  got:  %q\n  want: %q", i+1, gotLines[i], wantLines[i])
+		}
+	}
+	if len(gotLines) != len(wantLines) {
+		t.Errorf("%d lines, want %d lines", len(gotLines), len(wantLines))
+	}
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/uu64/nand2tetris/assembler/asm"
+)
+
+// maxSizeLabels is the number of labels listed in the size report.
+const maxSizeLabels = 10
+
+// size formats the ROM and RAM usage of the program.
+// The size of a label is the number of words from the label to the next label.
+func (cmd *Cmd) size(prog *asm.Program) *bytes.Buffer {
+	buf := bytes.NewBuffer([]byte{})
+	used := len(prog.Words)
+	fmt.Fprintf(buf, "%s:\n", cmd.asmfilePath)
+	fmt.Fprintf(buf, "  ROM        %5d / %d words (%.1f%%)\n", used, asm.ROMSize, float64(used)*100/asm.ROMSize)
+
+	vars := sortedSymbols(prog.Variables)
+	if len(vars) == 0 {
+		fmt.Fprintf(buf, "  variables  %5d\n", 0)
+	} else {
+		fmt.Fprintf(buf, "  variables  %5d (RAM %d-%d)\n", len(vars), vars[0].Address, vars[len(vars)-1].Address)
+	}
+
+	labels := sortedSymbols(prog.Labels)
+	type labelSize struct {
+		name  string
+		words int
+	}
+	sizes := make([]labelSize, len(labels))
+	for i, l := range labels {
+		end := used
+		for _, next := range labels[i+1:] {
+			if next.Address > l.Address {
+				end = next.Address
+				break
+			}
+		}
+		sizes[i] = labelSize{l.Name, end - l.Address}
+	}
+	sort.SliceStable(sizes, func(i, j int) bool {
+		return sizes[i].words > sizes[j].words
+	})
+	if len(sizes) > maxSizeLabels {
+		sizes = sizes[:maxSizeLabels]
+	}
+
+	if len(sizes) > 0 {
+		fmt.Fprintf(buf, "  largest labels\n")
+	}
+	for _, s := range sizes {
+		fmt.Fprintf(buf, "  %5d  %s\n", s.words, s.name)
+	}
+	return buf
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/uu64/nand2tetris/assembler/asm"
+)
+
+func TestSize(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{
+			src: "@i\nM=0\n(LOOP)\n@i\nM=M+1\n@j\nM=D\n@LOOP\n0;JMP\n(END)\n@END\n0;JMP\n",
+			want: "A.asm:\n" +
+				"  ROM           10 / 32768 words (0.0%)\n" +
+				"  variables      2 (RAM 16-17)\n" +
+				"  largest labels\n" +
+				"      6  LOOP\n" +
+				"      2  END\n",
+		},
+		{
+			// labels at the end of the program have no words
+			src: strings.Repeat("D=0\n", 3277) + "(A)\n(B)\n",
+			want: "A.asm:\n" +
+				"  ROM         3277 / 32768 words (10.0%)\n" +
+				"  variables      0\n" +
+				"  largest labels\n" +
+				"      0  A\n" +
+				"      0  B\n",
+		},
+	}
+
+	for _, tt := range tests {
+		prog, err := asm.Assemble(strings.NewReader(tt.src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := New("A.asm", "", Options{}).size(prog).String()
+		if got != tt.want {
+			t.Errorf("size() =\n%s\nwant\n%s", got, tt.want)
+		}
+	}
+}
+
+// TestSizeLabels checks that only the largest labels are listed.
+func TestSizeLabels(t *testing.T) {
+	var sb strings.Builder
+	for i := 1; i <= maxSizeLabels+2; i++ {
+		sb.WriteString("(L" + strings.Repeat("x", i) + ")\n" + strings.Repeat("D=0\n", i))
+	}
+	prog, err := asm.Assemble(strings.NewReader(sb.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(New("A.asm", "", Options{}).size(prog).String(), "\n"), "\n")
+	labels := lines[4:]
+	if len(labels) != maxSizeLabels {
+		t.Fatalf("%d labels are listed, want %d", len(labels), maxSizeLabels)
+	}
+	if want := "     12  L" + strings.Repeat("x", 12); labels[0] != want {
+		t.Errorf("largest label = %q, want %q", labels[0], want)
+	}
+	if want := "      3  Lxxx"; labels[len(labels)-1] != want {
+		t.Errorf("smallest listed label = %q, want %q", labels[len(labels)-1], want)
+	}
+}
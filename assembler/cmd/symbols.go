@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"sort"
+
+	"github.com/uu64/nand2tetris/assembler/asm"
+)
+
+// Symbol is a name bound to a ROM or RAM address.
+type Symbol struct {
+	Name    string `json:"name"`
+	Address int    `json:"address"`
+}
+
+// SymbolFile is the debug information written next to the hack file.
+// Files are the source files relative to the directory of Source, which is the first of them,
+// followed by the included files in the order of their first instructions.
+// Lines[addr] is the source line number of the instruction at ROM address addr,
+// in the file Files[LineFiles[addr]].
+type SymbolFile struct {
+	Source    string   `json:"source"`
+	Labels    []Symbol `json:"labels"`
+	Variables []Symbol `json:"variables"`
+	Files     []string `json:"files"`
+	Lines     []int    `json:"lines"`
+	LineFiles []int    `json:"lineFiles"`
+}
+
+func sortedSymbols(m map[string]int) []Symbol {
+	symbols := make([]Symbol, 0, len(m))
+	for name, addr := range m {
+		symbols = append(symbols, Symbol{name, addr})
+	}
+	sort.Slice(symbols, func(i, j int) bool {
+		if symbols[i].Address != symbols[j].Address {
+			return symbols[i].Address < symbols[j].Address
+		}
+		return symbols[i].Name < symbols[j].Name
+	})
+	return symbols
+}
+
+// symbols encodes the labels, variables and the line table of the program as JSON.
+func (cmd *Cmd) symbols(prog *asm.Program) ([]byte, error) {
+	dir := filepath.Dir(cmd.asmfilePath)
+	files := []string{filepath.Base(cmd.asmfilePath)}
+	index := map[string]int{cmd.asmfilePath: 0}
+	lines := make([]int, len(prog.Words))
+	lineFiles := make([]int, len(prog.Words))
+	for _, l := range prog.Lines {
+		if l.Kind != asm.Instruction {
+			continue
+		}
+		i, ok := index[l.File]
+		if !ok {
+			name, err := filepath.Rel(dir, l.File)
+			if err != nil {
+				name = l.File
+			}
+			i = len(files)
+			index[l.File] = i
+			files = append(files, filepath.ToSlash(name))
+		}
+		lines[l.Addr] = l.Number
+		lineFiles[l.Addr] = i
+	}
+
+	sf := &SymbolFile{
+		Source:    files[0],
+		Labels:    sortedSymbols(prog.Labels),
+		Variables: sortedSymbols(prog.Variables),
+		Files:     files,
+		Lines:     lines,
+		LineFiles: lineFiles,
+	}
+	return json.MarshalIndent(sf, "", "  ")
+}
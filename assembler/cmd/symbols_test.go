@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestSymbolsInclude checks that the line table of the symbol file points into the included file.
+func TestSymbolsInclude(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "lib"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"Main.asm":    "@1\n.include \"lib/Inc.asm\"\n(END)\n@END\n0;JMP\n",
+		"lib/Inc.asm": "// increments R1\nD=A\n@R1\nM=D+1\n",
+	}
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path := filepath.Join(dir, "Main.asm")
+	if err := New(path, "", Options{Format: "hack", Sym: true}).Run(); err != nil {
+		t.Fatalf("Run() = %v", err)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "Main.sym"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sf SymbolFile
+	if err := json.Unmarshal(b, &sf); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"Main.asm:1", "lib/Inc.asm:2", "lib/Inc.asm:3", "lib/Inc.asm:4", "Main.asm:4", "Main.asm:5"}
+	var got []string
+	for addr, line := range sf.Lines {
+		got = append(got, fmt.Sprintf("%s:%d", sf.Files[sf.LineFiles[addr]], line))
+	}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("lines = %v, want %v", got, want)
+	}
+	if sf.Source != "Main.asm" || sf.Files[0] != sf.Source {
+		t.Errorf("Source = %q, Files = %v", sf.Source, sf.Files)
+	}
+}
@@ -0,0 +1,187 @@
+// Package format writes machine words in the file formats which Hack computers load.
+package format
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Format is a file format of a ROM image.
+type Format interface {
+	// Ext returns the file extension including the dot.
+	Ext() string
+	// Encode writes the words to w.
+	Encode(w io.Writer, words []uint16) error
+}
+
+var formats = map[string]Format{}
+
+func init() {
+	Register("hack", hackFormat{})
+	Register("bin", binFormat{})
+	Register("hex", hexFormat{})
+	Register("ihex", intelHexFormat{})
+	Register("logisim", logisimFormat{})
+}
+
+// Register makes a format available by name.
+func Register(name string, f Format) {
+	formats[name] = f
+}
+
+// Lookup returns the format registered by name.
+func Lookup(name string) (Format, bool) {
+	f, ok := formats[name]
+	return f, ok
+}
+
+// Names returns the names of the registered formats in sorted order.
+func Names() []string {
+	names := make([]string, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Encode writes the words to w in the format registered by name.
+func Encode(w io.Writer, name string, words []uint16) error {
+	f, ok := Lookup(name)
+	if !ok {
+		return fmt.Errorf("Encode: unknown format: %s", name)
+	}
+
+	bw := bufio.NewWriter(w)
+	if err := f.Encode(bw, words); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// hackFormat is the text format of the book, a 16-digit binary number on each line.
+type hackFormat struct{}
+
+func (hackFormat) Ext() string {
+	return ".hack"
+}
+
+func (hackFormat) Encode(w io.Writer, words []uint16) error {
+	for _, word := range words {
+		if _, err := fmt.Fprintf(w, "%016b\n", word); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// binFormat is the raw words in big-endian.
+type binFormat struct{}
+
+func (binFormat) Ext() string {
+	return ".bin"
+}
+
+func (binFormat) Encode(w io.Writer, words []uint16) error {
+	return binary.Write(w, binary.BigEndian, words)
+}
+
+// hexFormat is a 4-digit hex number on each line.
+type hexFormat struct{}
+
+func (hexFormat) Ext() string {
+	return ".hex"
+}
+
+func (hexFormat) Encode(w io.Writer, words []uint16) error {
+	for _, word := range words {
+		if _, err := fmt.Fprintf(w, "%04X\n", word); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// intelHexFormat is Intel HEX. The words are stored in big-endian from byte address 0.
+type intelHexFormat struct{}
+
+// intelHexRecordSize is the number of data bytes in a record.
+const intelHexRecordSize = 16
+
+func (intelHexFormat) Ext() string {
+	return ".ihx"
+}
+
+func (intelHexFormat) Encode(w io.Writer, words []uint16) error {
+	data := make([]byte, 2*len(words))
+	for i, word := range words {
+		binary.BigEndian.PutUint16(data[2*i:], word)
+	}
+
+	record := func(addr int, typ byte, b []byte) error {
+		sum := byte(len(b)) + byte(addr>>8) + byte(addr) + typ
+		for _, c := range b {
+			sum += c
+		}
+		_, err := fmt.Fprintf(w, ":%02X%04X%02X%X%02X\n", len(b), addr, typ, b, -sum)
+		return err
+	}
+
+	for addr := 0; addr < len(data); addr += intelHexRecordSize {
+		end := addr + intelHexRecordSize
+		if end > len(data) {
+			end = len(data)
+		}
+		if err := record(addr, 0x00, data[addr:end]); err != nil {
+			return err
+		}
+	}
+	// end of file
+	return record(0, 0x01, nil)
+}
+
+// logisimFormat is the memory image of Logisim, "v2.0 raw".
+// A run of the same word is written as count*word.
+type logisimFormat struct{}
+
+// logisimLineSize is the number of entries on a line.
+const logisimLineSize = 8
+
+func (logisimFormat) Ext() string {
+	return ".img"
+}
+
+func (logisimFormat) Encode(w io.Writer, words []uint16) error {
+	entries := []string{}
+	for i := 0; i < len(words); {
+		n := 1
+		for i+n < len(words) && words[i+n] == words[i] {
+			n += 1
+		}
+		if n >= 3 {
+			entries = append(entries, fmt.Sprintf("%d*%x", n, words[i]))
+		} else {
+			for j := 0; j < n; j++ {
+				entries = append(entries, fmt.Sprintf("%x", words[i]))
+			}
+		}
+		i += n
+	}
+
+	if _, err := fmt.Fprintln(w, "v2.0 raw"); err != nil {
+		return err
+	}
+	for i, e := range entries {
+		sep := " "
+		if (i+1)%logisimLineSize == 0 || i == len(entries)-1 {
+			sep = "\n"
+		}
+		if _, err := fmt.Fprintf(w, "%s%s", e, sep); err != nil {
+			return err
+		}
+	}
+	return nil
+}
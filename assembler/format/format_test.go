@@ -0,0 +1,99 @@
+package format
+
+import (
+	"bytes"
+	"testing"
+)
+
+// add is the program of projects/06 Add.
+var add = []uint16{0x0002, 0xEC10, 0x0003, 0xE090, 0x0000, 0xE308}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		name  string
+		words []uint16
+		ext   string
+		want  string
+	}{
+		{
+			name:  "hack",
+			words: add,
+			ext:   ".hack",
+			want: "0000000000000010\n1110110000010000\n0000000000000011\n" +
+				"1110000010010000\n0000000000000000\n1110001100001000\n",
+		},
+		{
+			name:  "bin",
+			words: add,
+			ext:   ".bin",
+			want:  "\x00\x02\xEC\x10\x00\x03\xE0\x90\x00\x00\xE3\x08",
+		},
+		{
+			name:  "hex",
+			words: add,
+			ext:   ".hex",
+			want:  "0002\nEC10\n0003\nE090\n0000\nE308\n",
+		},
+		{
+			name:  "ihex",
+			words: add,
+			ext:   ".ihx",
+			want:  ":0C0000000002EC100003E0900000E30898\n:00000001FF\n",
+		},
+		{
+			// 18 bytes are split into a full record and a record at byte address 16
+			name:  "ihex",
+			words: make([]uint16, 9),
+			ext:   ".ihx",
+			want:  ":1000000000000000000000000000000000000000F0\n:020010000000EE\n:00000001FF\n",
+		},
+		{
+			name:  "ihex",
+			words: nil,
+			ext:   ".ihx",
+			want:  ":00000001FF\n",
+		},
+		{
+			name:  "logisim",
+			words: []uint16{1, 1, 1, 2, 2, 0, 0, 0, 0, 0xEC10},
+			ext:   ".img",
+			want:  "v2.0 raw\n3*1 2 2 4*0 ec10\n",
+		},
+		{
+			name:  "logisim",
+			words: []uint16{0, 1, 2, 3, 4, 5, 6, 7, 8},
+			ext:   ".img",
+			want:  "v2.0 raw\n0 1 2 3 4 5 6 7\n8\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, ok := Lookup(tt.name)
+			if !ok {
+				t.Fatalf("Lookup(%q) is not found", tt.name)
+			}
+			if f.Ext() != tt.ext {
+				t.Errorf("Ext() = %q, want %q", f.Ext(), tt.ext)
+			}
+
+			var buf bytes.Buffer
+			if err := Encode(&buf, tt.name, tt.words); err != nil {
+				t.Fatalf("Encode() = %v", err)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("Encode() = %q, want %q", buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestLookupUnknown(t *testing.T) {
+	if _, ok := Lookup("srec"); ok {
+		t.Errorf("Lookup(%q) is found", "srec")
+	}
+	var buf bytes.Buffer
+	if err := Encode(&buf, "srec", add); err == nil {
+		t.Errorf("Encode() of an unknown format succeeded")
+	}
+}
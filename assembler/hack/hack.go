@@ -0,0 +1,129 @@
+// Package hack represents the instructions of the Hack machine language
+// as typed values, which are converted from and to machine words.
+package hack
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/uu64/nand2tetris/assembler/internal/code"
+)
+
+// MaxValue is the largest value that an A instruction loads.
+const MaxValue = 1<<15 - 1
+
+// Kind is the kind of an instruction.
+type Kind int
+
+const (
+	// A loads a value into the A register, such as @100 or @LOOP.
+	A Kind = iota
+	// C computes comp, stores it into dest and jumps on jump, such as D=M;JGT.
+	C
+	// Label defines a symbol for the next ROM address, such as (LOOP).
+	// It is a pseudo-instruction and has no machine word.
+	Label
+)
+
+func (k Kind) String() string {
+	switch k {
+	case A:
+		return "A"
+	case C:
+		return "C"
+	case Label:
+		return "Label"
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// Instruction is an instruction of an asm source or a decoded machine word.
+//
+// Symbol is the symbol of an A instruction or a label. Value is the value of an A instruction,
+// which is set when the symbol is a constant or resolved by Resolve, and then Resolved is true.
+// Dest, Comp and Jump are the mnemonics of a C instruction, where "null" means omitted.
+type Instruction struct {
+	Kind     Kind
+	Symbol   string
+	Value    int
+	Resolved bool
+	Dest     string
+	Comp     string
+	Jump     string
+}
+
+// Resolve returns the A instruction with its symbol bound to the value.
+func (inst Instruction) Resolve(value int) Instruction {
+	inst.Value = value
+	inst.Resolved = true
+	return inst
+}
+
+// String returns the instruction as it is written in asm.
+// An A instruction without a symbol is written with its value.
+func (inst Instruction) String() string {
+	switch inst.Kind {
+	case A:
+		if inst.Symbol == "" {
+			return "@" + strconv.Itoa(inst.Value)
+		}
+		return "@" + inst.Symbol
+	case Label:
+		return "(" + inst.Symbol + ")"
+	}
+	s := inst.Comp
+	if inst.Dest != "null" && inst.Dest != "" {
+		s = inst.Dest + "=" + s
+	}
+	if inst.Jump != "null" && inst.Jump != "" {
+		s = s + ";" + inst.Jump
+	}
+	return s
+}
+
+// Encode returns the machine word of the instruction.
+// An A instruction with a symbol which is not resolved cannot be encoded.
+func (inst Instruction) Encode() (uint16, error) {
+	switch inst.Kind {
+	case A:
+		if inst.Symbol != "" && !inst.Resolved {
+			return 0, fmt.Errorf("Encode: unresolved symbol: %s", inst.Symbol)
+		}
+		if inst.Value < 0 || MaxValue < inst.Value {
+			return 0, fmt.Errorf("Encode: value out of range: %d", inst.Value)
+		}
+		return uint16(inst.Value), nil
+	case C:
+		w, ok := code.EncodeC(orNull(inst.Dest), inst.Comp, orNull(inst.Jump))
+		if !ok {
+			return 0, fmt.Errorf("Encode: invalid C instruction: %s", inst)
+		}
+		return w, nil
+	}
+	return 0, fmt.Errorf("Encode: %s instruction has no machine word: %s", inst.Kind, inst)
+}
+
+// Decode returns the instruction of the machine word.
+func Decode(w uint16) (Instruction, error) {
+	if w>>15 == 0 {
+		return Instruction{Kind: A, Value: int(w)}, nil
+	}
+	dest, comp, jump, ok := code.DecodeC(w)
+	if !ok {
+		return Instruction{}, fmt.Errorf("Decode: invalid C instruction: %016b", w)
+	}
+	return Instruction{Kind: C, Dest: dest, Comp: comp, Jump: jump}, nil
+}
+
+// UsesM reports whether the instruction reads or writes RAM[A].
+func (inst Instruction) UsesM() bool {
+	return inst.Kind == C && (strings.Contains(inst.Comp, "M") || strings.Contains(inst.Dest, "M"))
+}
+
+func orNull(mnemonic string) string {
+	if mnemonic == "" {
+		return "null"
+	}
+	return mnemonic
+}
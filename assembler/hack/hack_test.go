@@ -0,0 +1,33 @@
+package hack
+
+import "testing"
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		name    string
+		inst    Instruction
+		want    uint16
+		wantErr bool
+	}{
+		{name: "value", inst: Instruction{Kind: A, Value: 100}, want: 100},
+		{name: "resolved", inst: Instruction{Kind: A, Symbol: "LOOP"}.Resolve(4), want: 4},
+		{name: "resolved to 0", inst: Instruction{Kind: A, Symbol: "SP"}.Resolve(0), want: 0},
+		{name: "unresolved", inst: Instruction{Kind: A, Symbol: "LOOP"}, wantErr: true},
+		{name: "out of range", inst: Instruction{Kind: A, Value: MaxValue + 1}, wantErr: true},
+		{name: "C", inst: Instruction{Kind: C, Dest: "D", Comp: "A", Jump: "null"}, want: 0b1110110000010000},
+		{name: "invalid C", inst: Instruction{Kind: C, Comp: "X"}, wantErr: true},
+		{name: "label", inst: Instruction{Kind: Label, Symbol: "LOOP"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.inst.Encode()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Encode() = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Encode() = %016b, want %016b", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,5 +1,11 @@
 package code
 
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
 var compMap = map[string][]byte{
 	// a = 0
 	"0":   []byte("0101010"),
@@ -66,3 +72,147 @@ func Comp(mnemonic string) []byte {
 func Jump(mnemonic string) []byte {
 	return jumpMap[mnemonic]
 }
+
+// DestMnemonics returns all dest mnemonics in sorted order.
+func DestMnemonics() []string {
+	return mnemonics(destMap)
+}
+
+// CompMnemonics returns all comp mnemonics in sorted order.
+func CompMnemonics() []string {
+	return mnemonics(compMap)
+}
+
+// JumpMnemonics returns all jump mnemonics in sorted order.
+func JumpMnemonics() []string {
+	return mnemonics(jumpMap)
+}
+
+func mnemonics(m map[string][]byte) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var destNames = inverse(destMap)
+var compNames = inverse(compMap)
+var jumpNames = inverse(jumpMap)
+
+func inverse(m map[string][]byte) map[string]string {
+	inv := make(map[string]string, len(m))
+	for k, v := range m {
+		inv[string(v)] = k
+	}
+	return inv
+}
+
+// DecodeDest returns the dest mnemonic of the binary code such as "010".
+func DecodeDest(b []byte) (string, bool) {
+	mnemonic, ok := destNames[string(b)]
+	return mnemonic, ok
+}
+
+// DecodeComp returns the comp mnemonic of the binary code such as "0101010".
+func DecodeComp(b []byte) (string, bool) {
+	mnemonic, ok := compNames[string(b)]
+	return mnemonic, ok
+}
+
+// DecodeJump returns the jump mnemonic of the binary code such as "111".
+func DecodeJump(b []byte) (string, bool) {
+	mnemonic, ok := jumpNames[string(b)]
+	return mnemonic, ok
+}
+
+// compAliases maps the alternative spellings with commutative operands to the canonical ones.
+var compAliases = map[string]string{
+	"1+D": "D+1",
+	"1+A": "A+1",
+	"1+M": "M+1",
+	"A+D": "D+A",
+	"A&D": "D&A",
+	"A|D": "D|A",
+	"M+D": "D+M",
+	"M&D": "D&M",
+	"M|D": "D|M",
+}
+
+// destOrder is the order of registers in the canonical dest mnemonics.
+const destOrder = "AMD"
+
+// CanonicalComp returns the canonical spelling of comp written with swapped operands, such as D+A for A+D.
+func CanonicalComp(mnemonic string) (string, bool) {
+	if _, ok := compMap[mnemonic]; ok {
+		return mnemonic, true
+	}
+	canonical, ok := compAliases[mnemonic]
+	return canonical, ok
+}
+
+// CanonicalDest returns the canonical spelling of dest written with registers in any order, such as MD for DM.
+func CanonicalDest(mnemonic string) (string, bool) {
+	if _, ok := destMap[mnemonic]; ok {
+		return mnemonic, true
+	}
+
+	canonical := []byte{}
+	for _, r := range []byte(destOrder) {
+		switch strings.Count(mnemonic, string(r)) {
+		case 0:
+		case 1:
+			canonical = append(canonical, r)
+		default:
+			return "", false
+		}
+	}
+	if len(canonical) != len(mnemonic) {
+		return "", false
+	}
+	return string(canonical), true
+}
+
+// EncodeC returns the machine word of a C instruction.
+// The alternative spellings of dest and comp are accepted.
+func EncodeC(dest, comp, jump string) (uint16, bool) {
+	dest, ok := CanonicalDest(dest)
+	if !ok {
+		return 0, false
+	}
+	comp, ok = CanonicalComp(comp)
+	if !ok {
+		return 0, false
+	}
+	j, ok := jumpMap[jump]
+	if !ok {
+		return 0, false
+	}
+	return 0b111<<13 | bits(compMap[comp])<<6 | bits(destMap[dest])<<3 | bits(j), true
+}
+
+// DecodeC returns the mnemonics of the machine word of a C instruction.
+// It returns false if the word is not a C instruction or comp is unknown.
+func DecodeC(w uint16) (dest, comp, jump string, ok bool) {
+	if w>>13 != 0b111 {
+		return "", "", "", false
+	}
+	b := []byte(fmt.Sprintf("%016b", w))
+	comp, ok = DecodeComp(b[3:10])
+	if !ok {
+		return "", "", "", false
+	}
+	dest, _ = DecodeDest(b[10:13])
+	jump, _ = DecodeJump(b[13:16])
+	return dest, comp, jump, true
+}
+
+// bits converts a binary code such as "0101010" into a number.
+func bits(b []byte) uint16 {
+	var v uint16
+	for _, c := range b {
+		v = v<<1 | uint16(c-'0')
+	}
+	return v
+}
@@ -0,0 +1,71 @@
+package diag
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Diagnostic describes a problem found at a specific position of an asm file.
+// Line is 0 if the problem is not in a specific line, such as a problem found by the linker.
+type Diagnostic struct {
+	File     string
+	Line     int
+	Column   int
+	Text     string
+	Message  string
+	Expected []string
+}
+
+func (d *Diagnostic) Error() string {
+	var sb strings.Builder
+	if d.File != "" {
+		fmt.Fprintf(&sb, "%s:", d.File)
+	}
+	if d.Line > 0 {
+		fmt.Fprintf(&sb, "%d:%d:", d.Line, d.Column)
+	}
+	if sb.Len() > 0 {
+		sb.WriteString(" ")
+	}
+	sb.WriteString(d.Message)
+	if d.Text != "" {
+		fmt.Fprintf(&sb, ": %q", d.Text)
+	}
+	if len(d.Expected) > 0 {
+		fmt.Fprintf(&sb, " (expected %s)", strings.Join(d.Expected, ", "))
+	}
+	return sb.String()
+}
+
+// List is a collection of diagnostics reported as a single error.
+type List []*Diagnostic
+
+func (l List) Error() string {
+	msgs := make([]string, len(l))
+	for i, d := range l {
+		msgs[i] = d.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Err returns the list as an error, or nil if it is empty.
+func (l List) Err() error {
+	if len(l) == 0 {
+		return nil
+	}
+	return l
+}
+
+// Sort orders the diagnostics by file, line and column.
+func (l List) Sort() {
+	sort.SliceStable(l, func(i, j int) bool {
+		if l[i].File != l[j].File {
+			return l[i].File < l[j].File
+		}
+		if l[i].Line != l[j].Line {
+			return l[i].Line < l[j].Line
+		}
+		return l[i].Column < l[j].Column
+	})
+}
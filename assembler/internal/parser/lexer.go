@@ -0,0 +1,84 @@
+package parser
+
+type tokenKind int
+
+const (
+	tokAt tokenKind = iota
+	tokLParen
+	tokRParen
+	tokEqual
+	tokSemicolon
+	tokWord
+)
+
+// token is a lexical unit of a row. col is the 1-based column where it starts.
+type token struct {
+	kind tokenKind
+	text []byte
+	col  int
+}
+
+// lex splits a row into tokens.
+// Spaces, tabs and CR separate tokens, and a comment ends the row.
+// comment is true if the row has a comment.
+func lex(row []byte) (tokens []token, comment bool) {
+	for i := 0; i < len(row); {
+		c := row[i]
+		switch {
+		case isSpace(c):
+			i += 1
+			continue
+		case c == '/' && i+1 < len(row) && row[i+1] == '/':
+			return tokens, true
+		}
+
+		t := token{col: i + 1}
+		switch c {
+		case '@':
+			t.kind = tokAt
+		case '(':
+			t.kind = tokLParen
+		case ')':
+			t.kind = tokRParen
+		case '=':
+			t.kind = tokEqual
+		case ';':
+			t.kind = tokSemicolon
+		default:
+			start := i
+			for i < len(row) && !isSpace(row[i]) && !isDelim(row[i]) && !(row[i] == '/' && i+1 < len(row) && row[i+1] == '/') {
+				i += 1
+			}
+			t.kind = tokWord
+			t.text = row[start:i]
+			tokens = append(tokens, t)
+			continue
+		}
+		t.text = row[i : i+1]
+		tokens = append(tokens, t)
+		i += 1
+	}
+	return tokens, false
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r'
+}
+
+func isDelim(c byte) bool {
+	return c == '@' || c == '(' || c == ')' || c == '=' || c == ';'
+}
+
+// isSymbol reports whether b consists of the characters allowed in a symbol.
+// A symbol may start with a digit, which the labels generated by the VM translator do.
+func isSymbol(b []byte) bool {
+	for _, c := range b {
+		switch {
+		case '0' <= c && c <= '9', 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z':
+		case c == '_', c == ':', c == '.', c == '$':
+		default:
+			return false
+		}
+	}
+	return len(b) > 0
+}
@@ -3,9 +3,13 @@ package parser
 import (
 	"bufio"
 	"bytes"
+	"fmt"
 	"io"
-	"log"
-	"regexp"
+	"strconv"
+
+	"github.com/uu64/nand2tetris/assembler/hack"
+	"github.com/uu64/nand2tetris/assembler/internal/code"
+	"github.com/uu64/nand2tetris/assembler/internal/diag"
 )
 
 type Cmd int
@@ -19,14 +23,29 @@ const (
 	L_CMD
 )
 
+// Row is a line of source with the position it comes from.
+type Row struct {
+	File string
+	Line int
+	Text string
+}
+
 type Parser struct {
 	scanner         *bufio.Scanner
+	rows            []Row
 	hasMoreCommands bool
+	file            string
+	line            int
+	text            string
 	currentCmd      Cmd
 	symbol          []byte
 	dest            []byte
 	comp            []byte
 	jump            []byte
+	symbolCol       int
+	destCol         int
+	compCol         int
+	jumpCol         int
 }
 
 func New(f io.Reader) *Parser {
@@ -34,27 +53,66 @@ func New(f io.Reader) *Parser {
 	return &Parser{scanner: s, hasMoreCommands: true}
 }
 
+// NewRows returns a Parser which reads the rows made by a Preprocessor.
+func NewRows(rows []Row) *Parser {
+	return &Parser{rows: rows, hasMoreCommands: true}
+}
+
 func (p *Parser) HasMoreCommands() bool {
 	return p.hasMoreCommands
 }
 
-func (p *Parser) Advance() {
-	if !p.scanner.Scan() {
-		err := p.scanner.Err()
-		// io.EOF
-		if err == nil {
-			p.hasMoreCommands = false
-		} else {
-			log.Fatal("Parser.Advance: %w", err)
+// Advance reads the next row and parses it.
+// A syntax error is returned as a *diag.Diagnostic and the command type is set to UNKNOWN.
+func (p *Parser) Advance() error {
+	row, ok, err := p.next()
+	if !ok {
+		p.hasMoreCommands = false
+		p.currentCmd = EMPTY
+		return err
+	}
+	p.file = row.File
+	p.line = row.Line
+	return p.parse([]byte(row.Text))
+}
+
+// next returns the next row, or false at the end of the input.
+func (p *Parser) next() (Row, bool, error) {
+	if p.scanner == nil {
+		if len(p.rows) == 0 {
+			return Row{}, false, nil
 		}
+		row := p.rows[0]
+		p.rows = p.rows[1:]
+		return row, true, nil
+	}
+
+	if !p.scanner.Scan() {
+		// Err returns nil on io.EOF
+		return Row{}, false, p.scanner.Err()
 	}
-	p.parse(p.scanner.Bytes())
+	return Row{File: p.file, Line: p.line + 1, Text: p.scanner.Text()}, true, nil
 }
 
 func (p *Parser) CommandType() Cmd {
 	return p.currentCmd
 }
 
+// File returns the file name of the current row, which is empty unless the rows are preprocessed.
+func (p *Parser) File() string {
+	return p.file
+}
+
+// Line returns the 1-based line number of the current row.
+func (p *Parser) Line() int {
+	return p.line
+}
+
+// Text returns the current row as it is written in the source.
+func (p *Parser) Text() string {
+	return p.text
+}
+
 func (p *Parser) Symbol() string {
 	return string(p.symbol)
 }
@@ -71,48 +129,200 @@ func (p *Parser) Jump() string {
 	return string(p.jump)
 }
 
-var aCmdPtn = regexp.MustCompile(`^@(?P<symbol>[0-9A-Za-z_:\.\$]+)`)
-var lCmdPtn = regexp.MustCompile(`^\((?P<symbol>[0-9A-Za-z_:\.\$]+)\)`)
-var cCmdPtn = regexp.MustCompile(`^(?P<dest>null|[AMD]+)?=?(?P<comp>[AMD01&|+\-\!]+);?(?P<jump>null|JGT|JEQ|JGE|JLT|JNE|JLE|JMP)?`)
+// Instruction returns the current command as an instruction, or false if the current row is not a command.
+// The value of an A command is set if its symbol is a constant.
+func (p *Parser) Instruction() (hack.Instruction, bool) {
+	switch p.currentCmd {
+	case A_CMD:
+		inst := hack.Instruction{Kind: hack.A, Symbol: p.Symbol()}
+		if v, err := strconv.Atoi(inst.Symbol); err == nil {
+			inst = inst.Resolve(v)
+		}
+		return inst, true
+	case C_CMD:
+		return hack.Instruction{Kind: hack.C, Dest: p.Dest(), Comp: p.Comp(), Jump: p.Jump()}, true
+	case L_CMD:
+		return hack.Instruction{Kind: hack.Label, Symbol: p.Symbol()}, true
+	}
+	return hack.Instruction{}, false
+}
+
+// SymbolColumn returns the 1-based column where the symbol of the current command starts.
+func (p *Parser) SymbolColumn() int {
+	return p.symbolCol
+}
+
+// DestColumn returns the 1-based column where dest starts, or 0 if dest is omitted.
+func (p *Parser) DestColumn() int {
+	return p.destCol
+}
+
+// CompColumn returns the 1-based column where comp starts.
+func (p *Parser) CompColumn() int {
+	return p.compCol
+}
+
+// JumpColumn returns the 1-based column where jump starts, or 0 if jump is omitted.
+func (p *Parser) JumpColumn() int {
+	return p.jumpCol
+}
+
+var null = []byte("null")
+
+func (p *Parser) parse(row []byte) error {
+	p.text = string(row)
+	p.symbol, p.dest, p.comp, p.jump = nil, nil, nil, nil
+	p.symbolCol, p.destCol, p.compCol, p.jumpCol = 0, 0, 0, 0
 
-func (p *Parser) parse(row []byte) {
-	b := bytes.TrimSpace(row)
+	tokens, comment := lex(row)
 
 	// skip empty row
-	if len(b) == 0 {
-		p.currentCmd = EMPTY
-		return
+	if len(tokens) == 0 {
+		if comment {
+			p.currentCmd = COMMENT
+		} else {
+			p.currentCmd = EMPTY
+		}
+		return nil
 	}
 
-	// skip comment
-	if bytes.HasPrefix(b, []byte("//")) {
-		p.currentCmd = COMMENT
-		return
+	// the statement without the comment, which is shown in syntax errors
+	stmt := row
+	if i := bytes.Index(stmt, []byte("//")); i >= 0 {
+		stmt = stmt[:i]
 	}
+	stmt = bytes.TrimSpace(stmt)
+	col := tokens[0].col
 
-	switch b[0] {
-	case '@':
+	switch tokens[0].kind {
+	case tokAt:
 		// A command
-		matches := aCmdPtn.FindSubmatch(b)
-		if len(matches) > 0 {
-			p.symbol = matches[aCmdPtn.SubexpIndex("symbol")]
+		if len(tokens) != 2 || tokens[1].kind != tokWord || !isSymbol(tokens[1].text) {
+			return p.syntaxError(col, stmt, "invalid A command", "@value", "@symbol")
 		}
+		p.symbol, p.symbolCol = tokens[1].text, tokens[1].col
 		p.currentCmd = A_CMD
-	case '(':
+	case tokLParen:
 		// L command
-		matches := lCmdPtn.FindSubmatch(b)
-		if len(matches) > 0 {
-			p.symbol = matches[aCmdPtn.SubexpIndex("symbol")]
+		if len(tokens) != 3 || tokens[1].kind != tokWord || !isSymbol(tokens[1].text) || tokens[2].kind != tokRParen {
+			return p.syntaxError(col, stmt, "invalid L command", "(symbol)")
 		}
+		p.symbol, p.symbolCol = tokens[1].text, tokens[1].col
 		p.currentCmd = L_CMD
 	default:
 		// C command
-		matches := cCmdPtn.FindSubmatch(b)
-		if len(matches) > 0 {
-			p.dest = matches[cCmdPtn.SubexpIndex("dest")]
-			p.comp = matches[cCmdPtn.SubexpIndex("comp")]
-			p.jump = matches[cCmdPtn.SubexpIndex("jump")]
+		dest, comp, jump, ok := splitC(tokens)
+		if !ok {
+			return p.syntaxError(col, stmt, "invalid C command", "dest=comp;jump", "dest=comp", "comp;jump")
+		}
+		fields := []struct {
+			name      string
+			tokens    []token
+			known     func(string) bool
+			mnemonics []string
+		}{
+			{"dest", dest, isDest, code.DestMnemonics()},
+			{"comp", comp, isComp, code.CompMnemonics()},
+			{"jump", jump, isJump, code.JumpMnemonics()},
+		}
+		for _, f := range fields {
+			if len(f.tokens) > 1 {
+				first, last := f.tokens[0], f.tokens[len(f.tokens)-1]
+				text := row[first.col-1 : last.col-1+len(last.text)]
+				// the joined text is suggested only if it is a mnemonic
+				joined := string(join(f.tokens))
+				if !f.known(joined) {
+					return p.syntaxError(first.col, text, fmt.Sprintf("unknown %s mnemonic", f.name), f.mnemonics...)
+				}
+				return p.syntaxError(first.col, text, fmt.Sprintf("whitespace in %s mnemonic", f.name), joined)
+			}
+		}
+		p.dest, p.destCol = null, 0
+		if dest != nil {
+			p.dest, p.destCol = dest[0].text, dest[0].col
+		}
+		p.comp, p.compCol = comp[0].text, comp[0].col
+		p.jump, p.jumpCol = null, 0
+		if jump != nil {
+			p.jump, p.jumpCol = jump[0].text, jump[0].col
 		}
 		p.currentCmd = C_CMD
 	}
+	return nil
+}
+
+func isDest(mnemonic string) bool {
+	_, ok := code.CanonicalDest(mnemonic)
+	return ok
+}
+
+func isComp(mnemonic string) bool {
+	_, ok := code.CanonicalComp(mnemonic)
+	return ok
+}
+
+func isJump(mnemonic string) bool {
+	return code.Jump(mnemonic) != nil
+}
+
+// splitC splits the tokens of a C command into dest, comp and jump.
+// dest and jump are nil if they are omitted.
+func splitC(tokens []token) (dest, comp, jump []token, ok bool) {
+	eq, semi := -1, -1
+	for i, t := range tokens {
+		switch t.kind {
+		case tokWord:
+		case tokEqual:
+			if eq >= 0 || semi >= 0 {
+				return nil, nil, nil, false
+			}
+			eq = i
+		case tokSemicolon:
+			if semi >= 0 {
+				return nil, nil, nil, false
+			}
+			semi = i
+		default:
+			return nil, nil, nil, false
+		}
+	}
+
+	comp = tokens
+	if semi >= 0 {
+		comp, jump = tokens[:semi], tokens[semi+1:]
+		if len(jump) == 0 {
+			return nil, nil, nil, false
+		}
+	}
+	if eq >= 0 {
+		dest, comp = comp[:eq], comp[eq+1:]
+		if len(dest) == 0 {
+			return nil, nil, nil, false
+		}
+	}
+	if len(comp) == 0 {
+		return nil, nil, nil, false
+	}
+	return dest, comp, jump, true
+}
+
+// join concatenates the words of a mnemonic written with whitespace such as M - 1, which is suggested in the error.
+func join(tokens []token) []byte {
+	b := []byte{}
+	for _, t := range tokens {
+		b = append(b, t.text...)
+	}
+	return b
+}
+
+func (p *Parser) syntaxError(col int, b []byte, msg string, expected ...string) error {
+	p.currentCmd = UNKNOWN
+	return &diag.Diagnostic{
+		File:     p.file,
+		Line:     p.line,
+		Column:   col,
+		Text:     string(b),
+		Message:  msg,
+		Expected: expected,
+	}
 }
@@ -0,0 +1,231 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/uu64/nand2tetris/assembler/internal/diag"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		row     string
+		cmd     Cmd
+		symbol  string
+		dest    string
+		comp    string
+		jump    string
+		columns [4]int // symbol, dest, comp, jump
+	}{
+		{row: "", cmd: EMPTY},
+		{row: " \t\r", cmd: EMPTY},
+		{row: "// comment", cmd: COMMENT},
+		{row: "\t// comment", cmd: COMMENT},
+
+		{row: "@100", cmd: A_CMD, symbol: "100", columns: [4]int{2, 0, 0, 0}},
+		{row: "@LOOP", cmd: A_CMD, symbol: "LOOP", columns: [4]int{2, 0, 0, 0}},
+		{row: "@0.RET_ADDR", cmd: A_CMD, symbol: "0.RET_ADDR", columns: [4]int{2, 0, 0, 0}},
+		{row: "@Main.fib$ret.1", cmd: A_CMD, symbol: "Main.fib$ret.1", columns: [4]int{2, 0, 0, 0}},
+		{row: "  @i // counter", cmd: A_CMD, symbol: "i", columns: [4]int{4, 0, 0, 0}},
+		{row: "@ i", cmd: A_CMD, symbol: "i", columns: [4]int{3, 0, 0, 0}},
+		{row: "@i\r", cmd: A_CMD, symbol: "i", columns: [4]int{2, 0, 0, 0}},
+		{row: "@i//comment", cmd: A_CMD, symbol: "i", columns: [4]int{2, 0, 0, 0}},
+
+		{row: "(LOOP)", cmd: L_CMD, symbol: "LOOP", columns: [4]int{2, 0, 0, 0}},
+		{row: "\t( LOOP )\t// loop", cmd: L_CMD, symbol: "LOOP", columns: [4]int{4, 0, 0, 0}},
+
+		{row: "D=M", cmd: C_CMD, dest: "D", comp: "M", jump: "null", columns: [4]int{0, 1, 3, 0}},
+		{row: "D = M", cmd: C_CMD, dest: "D", comp: "M", jump: "null", columns: [4]int{0, 1, 5, 0}},
+		{row: "D=M // comment", cmd: C_CMD, dest: "D", comp: "M", jump: "null", columns: [4]int{0, 1, 3, 0}},
+		{row: "D=M//comment", cmd: C_CMD, dest: "D", comp: "M", jump: "null", columns: [4]int{0, 1, 3, 0}},
+		{row: "0;JMP", cmd: C_CMD, dest: "null", comp: "0", jump: "JMP", columns: [4]int{0, 0, 1, 3}},
+		{row: "0 ; JMP", cmd: C_CMD, dest: "null", comp: "0", jump: "JMP", columns: [4]int{0, 0, 1, 5}},
+		{row: "\tAM=M-1\r", cmd: C_CMD, dest: "AM", comp: "M-1", jump: "null", columns: [4]int{0, 2, 5, 0}},
+		{row: "AM = M-1", cmd: C_CMD, dest: "AM", comp: "M-1", jump: "null", columns: [4]int{0, 1, 6, 0}},
+		{row: "D=D-A;JGT", cmd: C_CMD, dest: "D", comp: "D-A", jump: "JGT", columns: [4]int{0, 1, 3, 7}},
+		{row: "MD=!M", cmd: C_CMD, dest: "MD", comp: "!M", jump: "null", columns: [4]int{0, 1, 4, 0}},
+		{row: "M=D|M", cmd: C_CMD, dest: "M", comp: "D|M", jump: "null", columns: [4]int{0, 1, 3, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.row, func(t *testing.T) {
+			p := New(strings.NewReader(tt.row))
+			if err := p.Advance(); err != nil {
+				t.Fatalf("Advance() = %v", err)
+			}
+			if p.CommandType() != tt.cmd {
+				t.Fatalf("CommandType() = %v, want %v", p.CommandType(), tt.cmd)
+			}
+			got := [4]string{p.Symbol(), p.Dest(), p.Comp(), p.Jump()}
+			want := [4]string{tt.symbol, tt.dest, tt.comp, tt.jump}
+			if got != want {
+				t.Errorf("symbol, dest, comp, jump = %q, want %q", got, want)
+			}
+			columns := [4]int{p.SymbolColumn(), p.DestColumn(), p.CompColumn(), p.JumpColumn()}
+			if columns != tt.columns {
+				t.Errorf("columns = %v, want %v", columns, tt.columns)
+			}
+			// the scanner drops CR at the end of a line
+			if want := strings.TrimSuffix(tt.row, "\r"); p.Text() != want {
+				t.Errorf("Text() = %q, want %q", p.Text(), want)
+			}
+		})
+	}
+}
+
+func TestParseError(t *testing.T) {
+	tests := []struct {
+		row      string
+		msg      string
+		column   int
+		text     string
+		expected string // the suggestion of a single mnemonic
+	}{
+		{row: "@", msg: "invalid A command", column: 1, text: "@"},
+		{row: "@a b", msg: "invalid A command", column: 1, text: "@a b"},
+		{row: "@a)", msg: "invalid A command", column: 1, text: "@a)"},
+		{row: "@-1", msg: "invalid A command", column: 1, text: "@-1"},
+		{row: "  @@a // comment", msg: "invalid A command", column: 3, text: "@@a"},
+		{row: "(LOOP", msg: "invalid L command", column: 1, text: "(LOOP"},
+		{row: "()", msg: "invalid L command", column: 1, text: "()"},
+		{row: "(A B)", msg: "invalid L command", column: 1, text: "(A B)"},
+		{row: "(LOOP))", msg: "invalid L command", column: 1, text: "(LOOP))"},
+		{row: "=M", msg: "invalid C command", column: 1, text: "=M"},
+		{row: "D=", msg: "invalid C command", column: 1, text: "D="},
+		{row: "D;", msg: "invalid C command", column: 1, text: "D;"},
+		{row: "D=M=A", msg: "invalid C command", column: 1, text: "D=M=A"},
+		{row: "D=M;JMP;JMP", msg: "invalid C command", column: 1, text: "D=M;JMP;JMP"},
+		{row: "0;JMP=D", msg: "invalid C command", column: 1, text: "0;JMP=D"},
+		{row: "\tD=@A", msg: "invalid C command", column: 2, text: "D=@A"},
+		{row: "AM = M - 1", msg: "whitespace in comp mnemonic", column: 6, text: "M - 1", expected: "M-1"},
+		{row: "A M=M-1", msg: "whitespace in dest mnemonic", column: 1, text: "A M", expected: "AM"},
+		{row: "0 ; J M P // jump", msg: "whitespace in jump mnemonic", column: 5, text: "J M P", expected: "JMP"},
+		{row: "\tD=M\t+1", msg: "whitespace in comp mnemonic", column: 4, text: "M\t+1", expected: "M+1"},
+		{row: "\tD=M\t1", msg: "unknown comp mnemonic", column: 4, text: "M\t1"},
+		{row: "D=foo bar", msg: "unknown comp mnemonic", column: 3, text: "foo bar"},
+		{row: "A X=M", msg: "unknown dest mnemonic", column: 1, text: "A X"},
+		{row: "0;JM Q", msg: "unknown jump mnemonic", column: 3, text: "JM Q"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.row, func(t *testing.T) {
+			p := New(strings.NewReader(tt.row))
+			err := p.Advance()
+			var d *diag.Diagnostic
+			if !errors.As(err, &d) {
+				t.Fatalf("Advance() = %v, want a diagnostic", err)
+			}
+			if d.Message != tt.msg || d.Column != tt.column || d.Text != tt.text {
+				t.Errorf("diagnostic = %q at %d (%q), want %q at %d (%q)", d.Message, d.Column, d.Text, tt.msg, tt.column, tt.text)
+			}
+			if tt.expected != "" && (len(d.Expected) != 1 || d.Expected[0] != tt.expected) {
+				t.Errorf("expected = %q, want %q", d.Expected, tt.expected)
+			}
+			if p.CommandType() != UNKNOWN {
+				t.Errorf("CommandType() = %v, want UNKNOWN", p.CommandType())
+			}
+		})
+	}
+}
+
+// TestParseProjects parses the symbol-less programs of projects/06, written in several styles,
+// and compares the encoded instructions with the hack files of projects/05.
+func TestParseProjects(t *testing.T) {
+	projects := filepath.Join("..", "..", "..", "projects")
+	programs := []struct {
+		asm  string
+		hack string
+	}{
+		{asm: "06/add/Add.asm", hack: "05/Add.hack"},
+		{asm: "06/max/MaxL.asm", hack: "05/Max.hack"},
+		{asm: "06/rect/RectL.asm", hack: "05/Rect.hack"},
+	}
+	styles := []struct {
+		name    string
+		rewrite func(line string) string
+	}{
+		{name: "as-is", rewrite: func(line string) string { return line }},
+		{name: "lf", rewrite: func(line string) string { return strings.TrimSuffix(line, "\r") }},
+		{name: "tabs", rewrite: func(line string) string { return "\t" + strings.TrimSpace(line) + "\t" }},
+		{name: "comments", rewrite: func(line string) string { return line + " // comment" }},
+		{name: "spaces", rewrite: func(line string) string {
+			line = strings.ReplaceAll(line, "=", " = ")
+			line = strings.ReplaceAll(line, ";", " ; ")
+			return "  " + line
+		}},
+	}
+
+	for _, prog := range programs {
+		src, err := os.ReadFile(filepath.Join(projects, prog.asm))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := os.ReadFile(filepath.Join(projects, prog.hack))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, style := range styles {
+			t.Run(fmt.Sprintf("%s/%s", prog.asm, style.name), func(t *testing.T) {
+				var b strings.Builder
+				for _, line := range strings.SplitAfter(string(src), "\n") {
+					eol := ""
+					if strings.HasSuffix(line, "\n") {
+						line, eol = strings.TrimSuffix(line, "\n"), "\n"
+					}
+					if strings.HasPrefix(strings.TrimSpace(line), "//") || strings.TrimSpace(line) == "" {
+						b.WriteString(line + eol)
+						continue
+					}
+					b.WriteString(style.rewrite(line) + eol)
+				}
+
+				got := encode(t, b.String())
+				compareLines(t, got, string(want))
+			})
+		}
+	}
+}
+
+// encode parses the source and returns the machine code in the hack format.
+func encode(t *testing.T, src string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	p := New(strings.NewReader(src))
+	for p.HasMoreCommands() {
+		if err := p.Advance(); err != nil {
+			t.Fatalf("Advance() = %v", err)
+		}
+		inst, ok := p.Instruction()
+		if !ok || p.CommandType() == L_CMD {
+			continue
+		}
+		w, err := inst.Encode()
+		if err != nil {
+			t.Fatalf("line %d: %v", p.Line(), err)
+		}
+		fmt.Fprintf(&buf, "%016b\n", w)
+	}
+	return buf.String()
+}
+
+func compareLines(t *testing.T, got, want string) {
+	t.Helper()
+	gs := bufio.NewScanner(strings.NewReader(got))
+	ws := bufio.NewScanner(strings.NewReader(want))
+	for n := 1; ; n++ {
+		g, w := gs.Scan(), ws.Scan()
+		if !g && !w {
+			return
+		}
+		if g != w || gs.Text() != strings.TrimSpace(ws.Text()) {
+			t.Fatalf("word %d: got %q, want %q", n-1, gs.Text(), strings.TrimSpace(ws.Text()))
+		}
+	}
+}
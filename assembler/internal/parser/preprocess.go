@@ -0,0 +1,285 @@
+package parser
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/uu64/nand2tetris/assembler/internal/diag"
+)
+
+const (
+	DIR_DEFINE  = ".define"
+	DIR_MACRO   = ".macro"
+	DIR_ENDM    = ".endm"
+	DIR_INCLUDE = ".include"
+	DIR_GLOBAL  = ".global"
+)
+
+// maxExpansionDepth limits nested macro expansion so that a recursive macro is reported instead of looping forever.
+const maxExpansionDepth = 64
+
+var identPtn = regexp.MustCompile(`^[A-Za-z_:\.\$][0-9A-Za-z_:\.\$]*$`)
+
+// wordPtn matches symbols and constants, which are the units replaced by .define and macro parameters.
+var wordPtn = regexp.MustCompile(`[0-9A-Za-z_:\.\$]+`)
+
+// localPtn matches a local label of a macro body such as %LOOP.
+var localPtn = regexp.MustCompile(`%[A-Za-z_:\.\$][0-9A-Za-z_:\.\$]*`)
+
+type macro struct {
+	name   string
+	params []string
+	body   []Row
+	at     Row
+}
+
+// Preprocessor expands .define, .macro and .include directives into plain asm rows.
+//
+//	.define NAME value    replaces the symbol NAME with value in the following rows
+//	.macro NAME [p ...]   starts a macro definition with parameters, ended by .endm
+//	.include "file.asm"   inserts the rows of file.asm, relative to the including file
+//	.global NAME [...]    exports the labels from an object, which are local to it otherwise
+//
+// A macro is invoked by a row such as "NAME arg1, arg2".
+// In a macro body, a label written as %LOOP is local to each expansion.
+type Preprocessor struct {
+	defines    map[string]string
+	macros     map[string]*macro
+	current    *macro
+	including  []string
+	expansions int
+	globals    map[string]Row
+	rows       []Row
+	diags      diag.List
+}
+
+func NewPreprocessor() *Preprocessor {
+	return &Preprocessor{
+		defines: map[string]string{},
+		macros:  map[string]*macro{},
+		globals: map[string]Row{},
+	}
+}
+
+// Globals returns the labels declared by .global with the rows of the first declarations.
+func (pp *Preprocessor) Globals() map[string]Row {
+	return pp.globals
+}
+
+// Process expands the directives of the source read from r.
+// name is the file name of the source and .include paths are resolved from its directory.
+// If the directives have problems, the returned error is a diag.List.
+func (pp *Preprocessor) Process(name string, r io.Reader) ([]Row, error) {
+	if err := pp.file(name, r); err != nil {
+		return nil, err
+	}
+	if err := pp.diags.Err(); err != nil {
+		return nil, err
+	}
+	return pp.rows, nil
+}
+
+func (pp *Preprocessor) file(name string, r io.Reader) error {
+	pp.including = append(pp.including, name)
+	defer func() {
+		pp.including = pp.including[:len(pp.including)-1]
+	}()
+
+	s := bufio.NewScanner(r)
+	line := 0
+	for s.Scan() {
+		line += 1
+		if err := pp.row(Row{File: name, Line: line, Text: s.Text()}, 0); err != nil {
+			return err
+		}
+	}
+	if err := s.Err(); err != nil {
+		return err
+	}
+
+	// a macro definition must be closed in the file where it starts
+	if pp.current != nil && pp.current.at.File == name {
+		pp.report(pp.current.at, "macro is not closed", DIR_ENDM)
+		pp.current = nil
+	}
+	return nil
+}
+
+func (pp *Preprocessor) row(r Row, depth int) error {
+	code, _ := splitComment(r.Text)
+	fields := strings.FieldsFunc(code, func(c rune) bool {
+		return c == ' ' || c == '\t' || c == ','
+	})
+
+	// collect the body of a macro
+	if pp.current != nil {
+		if len(fields) > 0 && fields[0] == DIR_ENDM {
+			pp.macros[pp.current.name] = pp.current
+			pp.current = nil
+			return nil
+		}
+		if len(fields) > 0 && fields[0] == DIR_MACRO {
+			pp.report(r, "nested macro definition", DIR_ENDM)
+			return nil
+		}
+		pp.current.body = append(pp.current.body, r)
+		return nil
+	}
+
+	if len(fields) == 0 {
+		pp.emit(r)
+		return nil
+	}
+
+	switch fields[0] {
+	case DIR_DEFINE:
+		if len(fields) != 3 || !identPtn.MatchString(fields[1]) {
+			pp.report(r, "invalid .define directive", ".define NAME value")
+			return nil
+		}
+		pp.defines[fields[1]] = pp.substitute(fields[2])
+	case DIR_MACRO:
+		if len(fields) < 2 || !identPtn.MatchString(fields[1]) {
+			pp.report(r, "invalid .macro directive", ".macro NAME [param ...]")
+			return nil
+		}
+		for _, param := range fields[2:] {
+			if !identPtn.MatchString(param) {
+				pp.report(r, fmt.Sprintf("invalid macro parameter %s", param), ".macro NAME [param ...]")
+				return nil
+			}
+		}
+		pp.current = &macro{name: fields[1], params: fields[2:], at: r}
+	case DIR_ENDM:
+		pp.report(r, ".endm without .macro", DIR_MACRO)
+	case DIR_INCLUDE:
+		if len(fields) != 2 {
+			pp.report(r, "invalid .include directive", `.include "file.asm"`)
+			return nil
+		}
+		return pp.include(r, strings.Trim(fields[1], `"`))
+	case DIR_GLOBAL:
+		if len(fields) < 2 {
+			pp.report(r, "invalid .global directive", ".global NAME [...]")
+			return nil
+		}
+		for _, name := range fields[1:] {
+			name = pp.substitute(name)
+			if !identPtn.MatchString(name) {
+				pp.report(r, fmt.Sprintf("invalid global label %s", name), ".global NAME [...]")
+				continue
+			}
+			if _, ok := pp.globals[name]; !ok {
+				pp.globals[name] = r
+			}
+		}
+	default:
+		if m, ok := pp.macros[fields[0]]; ok {
+			return pp.expand(r, m, fields[1:], depth)
+		}
+		if strings.HasPrefix(fields[0], ".") {
+			pp.report(r, "unknown directive", DIR_DEFINE, DIR_MACRO, DIR_ENDM, DIR_INCLUDE, DIR_GLOBAL)
+			return nil
+		}
+		pp.emit(r)
+	}
+	return nil
+}
+
+func (pp *Preprocessor) include(r Row, path string) error {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(r.File), path)
+	}
+	for _, name := range pp.including {
+		if name == path {
+			pp.report(r, "include cycle")
+			return nil
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		pp.report(r, fmt.Sprintf("cannot include file: %v", err))
+		return nil
+	}
+	defer f.Close()
+
+	return pp.file(path, f)
+}
+
+func (pp *Preprocessor) expand(r Row, m *macro, args []string, depth int) error {
+	if depth >= maxExpansionDepth {
+		pp.report(r, fmt.Sprintf("macro %s is expanded too deeply", m.name))
+		return nil
+	}
+	if len(args) != len(m.params) {
+		pp.report(r, fmt.Sprintf("macro %s takes %d arguments, got %d", m.name, len(m.params), len(args)))
+		return nil
+	}
+
+	pp.expansions += 1
+	id := pp.expansions
+	bind := map[string]string{}
+	for i, param := range m.params {
+		bind[param] = args[i]
+	}
+
+	for _, b := range m.body {
+		code, comment := splitComment(b.Text)
+		code = wordPtn.ReplaceAllStringFunc(code, func(w string) string {
+			if arg, ok := bind[w]; ok {
+				return arg
+			}
+			return w
+		})
+		code = localPtn.ReplaceAllStringFunc(code, func(l string) string {
+			return fmt.Sprintf("%s.%d$%s", m.name, id, l[1:])
+		})
+
+		// the expanded rows are located at the invocation
+		if err := pp.row(Row{File: r.File, Line: r.Line, Text: code + comment}, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// substitute replaces the defined names in s.
+func (pp *Preprocessor) substitute(s string) string {
+	return wordPtn.ReplaceAllStringFunc(s, func(w string) string {
+		if v, ok := pp.defines[w]; ok {
+			return v
+		}
+		return w
+	})
+}
+
+func (pp *Preprocessor) emit(r Row) {
+	code, comment := splitComment(r.Text)
+	pp.rows = append(pp.rows, Row{File: r.File, Line: r.Line, Text: pp.substitute(code) + comment})
+}
+
+func (pp *Preprocessor) report(r Row, msg string, expected ...string) {
+	code, _ := splitComment(r.Text)
+	pp.diags = append(pp.diags, &diag.Diagnostic{
+		File:     r.File,
+		Line:     r.Line,
+		Column:   len(code) - len(strings.TrimLeft(code, " \t")) + 1,
+		Text:     strings.TrimSpace(code),
+		Message:  msg,
+		Expected: expected,
+	})
+}
+
+// splitComment splits a row into the code and the trailing comment.
+func splitComment(s string) (string, string) {
+	if i := strings.Index(s, "//"); i >= 0 {
+		return s[:i], s[i:]
+	}
+	return s, ""
+}
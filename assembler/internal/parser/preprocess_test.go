@@ -0,0 +1,162 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/uu64/nand2tetris/assembler/internal/diag"
+)
+
+// lines formats the rows as "line: text" to compare them with the expected expansion.
+func lines(rows []Row) []string {
+	s := make([]string, len(rows))
+	for i, r := range rows {
+		s[i] = fmt.Sprintf("%d: %s", r.Line, r.Text)
+	}
+	return s
+}
+
+func TestPreprocess(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{
+			name: "define",
+			src:  ".define N 10\n@N\nD=A // N\n",
+			want: []string{"2: @10", "3: D=A // N"},
+		},
+		{
+			name: "define of define",
+			src:  ".define A0 5\n.define B0 A0\n@B0\n@B0X\n",
+			want: []string{"3: @5", "4: @B0X"},
+		},
+		{
+			name: "macro parameters",
+			src:  ".macro COPY src, dst\n@src\nD=M\n@dst\nM=D\n.endm\n@0\nCOPY x, y\n",
+			want: []string{"7: @0", "8: @x", "8: D=M", "8: @y", "8: M=D"},
+		},
+		{
+			name: "macro with define",
+			src:  ".define LIMIT 100\n.macro SET n\n@n\n.endm\nSET LIMIT\n",
+			want: []string{"5: @100"},
+		},
+		{
+			name: "local labels",
+			src:  ".macro LOOPN\n(%LOOP)\n@%LOOP\nD;JGT\n.endm\nLOOPN\nLOOPN\n",
+			want: []string{
+				"6: (LOOPN.1$LOOP)", "6: @LOOPN.1$LOOP", "6: D;JGT",
+				"7: (LOOPN.2$LOOP)", "7: @LOOPN.2$LOOP", "7: D;JGT",
+			},
+		},
+		{
+			name: "nested macro",
+			src:  ".macro INNER\n(%L)\n.endm\n.macro OUTER\nINNER\n(%L)\n.endm\nOUTER\n",
+			want: []string{"8: (INNER.2$L)", "8: (OUTER.1$L)"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := NewPreprocessor().Process("A.asm", strings.NewReader(tt.src))
+			if err != nil {
+				t.Fatalf("Process() = %v", err)
+			}
+			got := lines(rows)
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("Process() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+// processError returns the diagnostics of a source which is expected to have problems.
+func processError(t *testing.T, name, src string) diag.List {
+	t.Helper()
+	_, err := NewPreprocessor().Process(name, strings.NewReader(src))
+	var diags diag.List
+	if !errors.As(err, &diags) {
+		t.Fatalf("Process() = %v, want a diag.List", err)
+	}
+	return diags
+}
+
+func TestPreprocessError(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "too many arguments",
+			src:  ".macro M a\n@a\n.endm\nM 1, 2\n",
+			want: `A.asm:4:1: macro M takes 1 arguments, got 2: "M 1, 2"`,
+		},
+		{
+			name: "too few arguments",
+			src:  ".macro M a b\n@a\n.endm\n  M 1\n",
+			want: `A.asm:4:3: macro M takes 2 arguments, got 1: "M 1"`,
+		},
+		{
+			name: "recursion",
+			src:  ".macro R\nR\n.endm\nR\n",
+			want: `A.asm:4:1: macro R is expanded too deeply: "R"`,
+		},
+		{
+			name: "unclosed macro",
+			src:  "@1\n.macro M\n@2\n",
+			want: `A.asm:2:1: macro is not closed: ".macro M" (expected .endm)`,
+		},
+		{
+			name: "stray endm",
+			src:  "@1\n  .endm // end\n",
+			want: `A.asm:2:3: .endm without .macro: ".endm" (expected .macro)`,
+		},
+		{
+			name: "nested macro definition",
+			src:  ".macro M\n.macro N\n.endm\n",
+			want: `A.asm:2:1: nested macro definition: ".macro N" (expected .endm)`,
+		},
+		{
+			name: "invalid define",
+			src:  ".define 1N 10\n",
+			want: `A.asm:1:1: invalid .define directive: ".define 1N 10" (expected .define NAME value)`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diags := processError(t, "A.asm", tt.src)
+			if len(diags) != 1 || diags[0].Error() != tt.want {
+				t.Errorf("Process() = %v, want %s", diags, tt.want)
+			}
+		})
+	}
+}
+
+func TestIncludeCycle(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.asm")
+	b := filepath.Join(dir, "b.asm")
+	if err := os.WriteFile(a, []byte("@1\n.include \"b.asm\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(b, []byte("@2\n.include \"a.asm\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := os.ReadFile(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	diags := processError(t, a, string(src))
+	want := fmt.Sprintf(`%s:2:1: include cycle: ".include \"a.asm\""`, b)
+	if len(diags) != 1 || diags[0].Error() != want {
+		t.Errorf("Process() = %v, want %s", diags, want)
+	}
+}
@@ -45,3 +45,12 @@ func (st *SymbolTable) Contains(symbol string) bool {
 func (st *SymbolTable) GetAddress(symbol string) int {
 	return st.table[symbol]
 }
+
+// Entries returns a copy of the symbols and their addresses.
+func (st *SymbolTable) Entries() map[string]int {
+	entries := make(map[string]int, len(st.table))
+	for symbol, address := range st.table {
+		entries[symbol] = address
+	}
+	return entries
+}
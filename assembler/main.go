@@ -1,25 +1,245 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
+	"io/fs"
 	"log"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
 
 	"github.com/uu64/nand2tetris/assembler/cmd"
+	"github.com/uu64/nand2tetris/assembler/format"
+	"github.com/uu64/nand2tetris/assembler/internal/diag"
 )
 
+const (
+	extAsm = ".asm"
+)
+
+var outputFlag = flag.String("o", "", "output file, or output directory if there are multiple inputs")
+var listFlag = flag.Bool("list", false, "write a listing file (.lst) next to the output")
+var symFlag = flag.Bool("sym", false, "write a symbol file (.sym) next to the output")
+var strictFlag = flag.Bool("strict", false, "reject alternative spellings such as A+D and DM")
+var formatFlag = flag.String("format", "hack", "output format: "+strings.Join(format.Names(), ", "))
+var optimizeFlag = flag.Bool("O", false, "apply peephole optimizations")
+var sizeFlag = flag.Bool("size", false, "print the ROM and RAM usage")
+var objectFlag = flag.Bool("c", false, "write relocatable objects ("+cmd.ExtObject+") instead of programs")
+var linkFlag = flag.Bool("link", false, "link object files into a program")
+var disasmFlag = flag.Bool("d", false, "disassemble a hack file into .dis.asm")
+var namesFlag = flag.String("names", "", "symbol file (.sym) to restore names when disassembling")
+
 func usage() {
-	fmt.Println("usage: asmc /path/to/file.asm")
+	fmt.Println("usage: asmc [-o output] [-format name] [-list] [-sym] [-strict] [-O] [-size] input [input ...]")
+	fmt.Println("       asmc -c [-o output] [-strict] [-O] input [input ...]")
+	fmt.Println("       asmc -link [-o output] [-format name] [-size] object [object ...]")
+	fmt.Println("       asmc -d [-o output] [-names file.sym] /path/to/file.hack")
+}
+
+// inputs returns the files given by the arguments. A directory is walked to find the files with ext.
+// multiple is true if the inputs are not a single file.
+func inputs(args []string, ext string) (paths []string, multiple bool, err error) {
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, false, err
+		}
+		if !info.IsDir() {
+			paths = append(paths, arg)
+			continue
+		}
+
+		multiple = true
+		err = filepath.WalkDir(arg, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && strings.HasSuffix(d.Name(), ext) {
+				paths = append(paths, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	return paths, multiple || len(paths) > 1, nil
+}
+
+// outputs returns the output path of each input.
+// For multiple inputs, the output is the directory which the outputs are written into.
+func outputs(inputs []string, output, ext string, multiple bool) ([]string, error) {
+	paths := make([]string, len(inputs))
+	if output == "" {
+		return paths, nil
+	}
+	if !multiple {
+		paths[0] = output
+		return paths, nil
+	}
+
+	if err := os.MkdirAll(output, 0755); err != nil {
+		return nil, err
+	}
+	seen := map[string]string{}
+	for i, input := range inputs {
+		name := filepath.Base(input)
+		path := filepath.Join(output, strings.TrimSuffix(name, filepath.Ext(name))+ext)
+		if prev, ok := seen[path]; ok {
+			return nil, fmt.Errorf("%s and %s are both written to %s", prev, input, path)
+		}
+		seen[path] = input
+		paths[i] = path
+	}
+	return paths, nil
+}
+
+// unsupported returns an error if the options need what the mode does not have.
+// An object is not a program, and a linked program has no source lines.
+func unsupported(opts cmd.Options, link bool) error {
+	var mode string
+	var flags []string
+	switch {
+	case link:
+		mode = "-link"
+		if opts.List {
+			flags = append(flags, "-list")
+		}
+		if opts.Sym {
+			flags = append(flags, "-sym")
+		}
+		if opts.Strict {
+			flags = append(flags, "-strict")
+		}
+		if opts.Optimize {
+			flags = append(flags, "-O")
+		}
+	case opts.Object:
+		mode = "-c"
+		if opts.List {
+			flags = append(flags, "-list")
+		}
+		if opts.Sym {
+			flags = append(flags, "-sym")
+		}
+		if opts.Size {
+			flags = append(flags, "-size")
+		}
+	}
+	if len(flags) > 0 {
+		return fmt.Errorf("%s cannot be used with %s", strings.Join(flags, ", "), mode)
+	}
+	return nil
+}
+
+// assemble assembles the files concurrently, and returns the error of each file in the order of the inputs.
+func assemble(paths, outputPaths []string, opts cmd.Options) []error {
+	errs := make([]error, len(paths))
+	sem := make(chan struct{}, runtime.NumCPU())
+	var wg sync.WaitGroup
+	for i := range paths {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			errs[i] = cmd.New(paths[i], outputPaths[i], opts).Run()
+		}(i)
+	}
+	wg.Wait()
+	return errs
+}
+
+// report prints the error of an input.
+func report(input string, err error) {
+	var diags diag.List
+	if errors.As(err, &diags) {
+		for _, d := range diags {
+			fmt.Fprintln(os.Stderr, d)
+		}
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%s: %v\n", input, err)
 }
 
 func main() {
-	if len(os.Args) < 2 {
+	flag.Parse()
+	if flag.NArg() < 1 {
 		usage()
 		return
 	}
 
-	cmd := cmd.New(os.Args[1])
-	if err := cmd.Run(); err != nil {
+	if *disasmFlag {
+		if err := cmd.NewDisasm(flag.Arg(0), *outputFlag, *namesFlag).Run(); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	f, ok := format.Lookup(*formatFlag)
+	if !ok {
+		log.Fatalf("unknown format: %s", *formatFlag)
+	}
+
+	opts := cmd.Options{
+		List:     *listFlag,
+		Sym:      *symFlag,
+		Strict:   *strictFlag,
+		Format:   *formatFlag,
+		Object:   *objectFlag,
+		Optimize: *optimizeFlag,
+		Size:     *sizeFlag,
+	}
+	if err := unsupported(opts, *linkFlag); err != nil {
+		log.Fatal(err)
+	}
+
+	if *linkFlag {
+		paths, _, err := inputs(flag.Args(), cmd.ExtObject)
+		if err != nil {
+			log.Fatal(err)
+		}
+		output := *outputFlag
+		if output == "" {
+			output = "out" + f.Ext()
+		}
+		if err := cmd.NewLink(paths, output, opts).Run(); err != nil {
+			report(output, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	paths, multiple, err := inputs(flag.Args(), extAsm)
+	if err != nil {
 		log.Fatal(err)
 	}
+	if len(paths) == 0 {
+		log.Fatal("no asm files")
+	}
+
+	ext := f.Ext()
+	if *objectFlag {
+		ext = cmd.ExtObject
+	}
+	outputPaths, err := outputs(paths, *outputFlag, ext, multiple)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	errs := assemble(paths, outputPaths, opts)
+	failed := false
+	for i, err := range errs {
+		if err != nil {
+			report(paths[i], err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/uu64/nand2tetris/assembler/cmd"
+	"github.com/uu64/nand2tetris/assembler/internal/diag"
+)
+
+// writeFiles writes the files relative to dir.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, src := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestOutputs(t *testing.T) {
+	dir := t.TempDir()
+
+	// -o is the output file of a single input
+	paths, err := outputs([]string{"Add.asm"}, filepath.Join(dir, "add.hack"), ".hack", false)
+	if err != nil || len(paths) != 1 || paths[0] != filepath.Join(dir, "add.hack") {
+		t.Errorf("outputs() of a single input = %v, %v", paths, err)
+	}
+
+	// -o is the output directory of multiple inputs
+	out := filepath.Join(dir, "out")
+	paths, err = outputs([]string{"add/Add.asm", "max/Max.asm"}, out, ".hex", true)
+	if err != nil {
+		t.Fatalf("outputs() of multiple inputs = %v", err)
+	}
+	want := []string{filepath.Join(out, "Add.hex"), filepath.Join(out, "Max.hex")}
+	if strings.Join(paths, " ") != strings.Join(want, " ") {
+		t.Errorf("outputs() of multiple inputs = %v, want %v", paths, want)
+	}
+	if info, err := os.Stat(out); err != nil || !info.IsDir() {
+		t.Errorf("output directory is not created: %v", err)
+	}
+
+	// inputs with the same name would overwrite each other
+	if _, err := outputs([]string{"a/Main.asm", "b/Main.asm"}, out, ".hack", true); err == nil {
+		t.Errorf("outputs() of inputs with the same name succeeded")
+	}
+
+	// without -o, the outputs are next to the inputs
+	paths, err = outputs([]string{"add/Add.asm", "max/Max.asm"}, "", ".hack", true)
+	if err != nil || len(paths) != 2 || paths[0] != "" || paths[1] != "" {
+		t.Errorf("outputs() without -o = %q, %v", paths, err)
+	}
+}
+
+// TestAssembleDefaultOutput assembles a directory without -o, which writes each .hack next to its source.
+func TestAssembleDefaultOutput(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"Add.asm":     "@2\nD=A\n",
+		"sub/Max.asm": "@R0\nD=M\n",
+		"notes.txt":   "not an asm file",
+	})
+
+	paths, multiple, err := inputs([]string{dir}, extAsm)
+	if err != nil || !multiple || len(paths) != 2 {
+		t.Fatalf("inputs() = %v, %v, %v", paths, multiple, err)
+	}
+	outputPaths, err := outputs(paths, "", ".hack", multiple)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, err := range assemble(paths, outputPaths, cmd.Options{Format: "hack"}) {
+		if err != nil {
+			t.Errorf("assemble(%s) = %v", paths[i], err)
+		}
+	}
+
+	for _, name := range []string{"Add.hack", "sub/Max.hack"} {
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name))); err != nil {
+			t.Errorf("%s is not written: %v", name, err)
+		}
+	}
+}
+
+// TestAssembleErrors assembles several invalid files concurrently,
+// and checks that the error of each file is returned at its index.
+func TestAssembleErrors(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{}
+	var paths []string
+	for _, name := range []string{"A.asm", "B.asm", "C.asm", "D.asm", "E.asm", "F.asm", "G.asm", "H.asm"} {
+		files[name] = "@1\nD=X\n"
+		paths = append(paths, filepath.Join(dir, name))
+	}
+	writeFiles(t, dir, files)
+
+	outputPaths, err := outputs(paths, filepath.Join(dir, "out"), ".hack", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := assemble(paths, outputPaths, cmd.Options{Format: "hack"})
+	for i, err := range errs {
+		var diags diag.List
+		if !errors.As(err, &diags) || len(diags) != 1 {
+			t.Errorf("assemble(%s) = %v, want a diagnostic", paths[i], err)
+			continue
+		}
+		if diags[0].File != paths[i] || diags[0].Line != 2 {
+			t.Errorf("assemble(%s) = %v, want a diagnostic at %s:2", paths[i], err, paths[i])
+		}
+	}
+}
+
+func TestUnsupported(t *testing.T) {
+	tests := []struct {
+		opts cmd.Options
+		link bool
+		want string
+	}{
+		{opts: cmd.Options{List: true, Sym: true, Strict: true, Optimize: true, Size: true}},
+		{opts: cmd.Options{Size: true}, link: true},
+		{opts: cmd.Options{Strict: true, Optimize: true, Object: true}},
+		{opts: cmd.Options{Sym: true}, link: true, want: "-sym cannot be used with -link"},
+		{opts: cmd.Options{List: true, Optimize: true}, link: true, want: "-list, -O cannot be used with -link"},
+		{opts: cmd.Options{Strict: true}, link: true, want: "-strict cannot be used with -link"},
+		{opts: cmd.Options{Object: true, List: true, Sym: true, Size: true}, want: "-list, -sym, -size cannot be used with -c"},
+	}
+
+	for _, tt := range tests {
+		err := unsupported(tt.opts, tt.link)
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != tt.want {
+			t.Errorf("unsupported(%+v, %v) = %q, want %q", tt.opts, tt.link, got, tt.want)
+		}
+	}
+}
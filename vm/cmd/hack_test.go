@@ -0,0 +1,208 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// cpu executes asm source directly, which is enough to compare the outputs of the translator
+// without an assembler.
+type cpu struct {
+	rom []instruction
+	ram [32768]int16
+	a   int16
+	d   int16
+	pc  int
+}
+
+type instruction struct {
+	isA   bool
+	value int16
+	dest  string
+	comp  string
+	jump  string
+}
+
+var predefined = map[string]int{
+	"SP": 0, "LCL": 1, "ARG": 2, "THIS": 3, "THAT": 4,
+	"SCREEN": 16384, "KBD": 24576,
+}
+
+func init() {
+	for i := 0; i < 16; i++ {
+		predefined[fmt.Sprintf("R%d", i)] = i
+	}
+}
+
+// newCPU loads the asm source, resolving labels and variables like the assembler.
+func newCPU(src string) (*cpu, error) {
+	lines := []string{}
+	for _, line := range strings.Split(src, "\n") {
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	symbols := map[string]int{}
+	for name, addr := range predefined {
+		symbols[name] = addr
+	}
+	addr := 0
+	for _, line := range lines {
+		if strings.HasPrefix(line, "(") {
+			symbols[strings.Trim(line, "()")] = addr
+			continue
+		}
+		addr += 1
+	}
+
+	c := &cpu{}
+	ramAddr := 16
+	for _, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "("):
+		case strings.HasPrefix(line, "@"):
+			symbol := line[1:]
+			v, err := strconv.Atoi(symbol)
+			if err != nil {
+				var ok bool
+				if v, ok = symbols[symbol]; !ok {
+					v = ramAddr
+					symbols[symbol] = v
+					ramAddr += 1
+				}
+			}
+			c.rom = append(c.rom, instruction{isA: true, value: int16(v)})
+		default:
+			inst := instruction{dest: "", comp: line, jump: ""}
+			if i := strings.Index(inst.comp, "="); i >= 0 {
+				inst.dest, inst.comp = inst.comp[:i], inst.comp[i+1:]
+			}
+			if i := strings.Index(inst.comp, ";"); i >= 0 {
+				inst.comp, inst.jump = inst.comp[:i], inst.comp[i+1:]
+			}
+			if _, err := c.eval(inst.comp); err != nil {
+				return nil, err
+			}
+			c.rom = append(c.rom, inst)
+		}
+	}
+	return c, nil
+}
+
+func (c *cpu) reg(r byte) int16 {
+	switch r {
+	case 'A':
+		return c.a
+	case 'D':
+		return c.d
+	case 'M':
+		return c.ram[uint16(c.a)&0x7fff]
+	}
+	panic(fmt.Sprintf("unknown register %c", r))
+}
+
+func isReg(s string) bool {
+	return len(s) == 1 && strings.Contains("ADM", s)
+}
+
+// eval computes comp, which may be written with swapped operands.
+func (c *cpu) eval(comp string) (int16, error) {
+	switch comp {
+	case "0":
+		return 0, nil
+	case "1":
+		return 1, nil
+	case "-1":
+		return -1, nil
+	}
+	if isReg(comp) {
+		return c.reg(comp[0]), nil
+	}
+	if len(comp) == 2 && isReg(comp[1:]) {
+		switch comp[0] {
+		case '!':
+			return ^c.reg(comp[1]), nil
+		case '-':
+			return -c.reg(comp[1]), nil
+		}
+	}
+	if len(comp) == 3 && isReg(comp[:1]) {
+		x := c.reg(comp[0])
+		var y int16
+		switch {
+		case comp[2] == '1':
+			y = 1
+		case isReg(comp[2:]):
+			y = c.reg(comp[2])
+		default:
+			return 0, fmt.Errorf("unknown comp %s", comp)
+		}
+		switch comp[1] {
+		case '+':
+			return x + y, nil
+		case '-':
+			return x - y, nil
+		case '&':
+			return x & y, nil
+		case '|':
+			return x | y, nil
+		}
+	}
+	if len(comp) == 3 && comp[0] == '1' && comp[1] == '+' && isReg(comp[2:]) {
+		return c.reg(comp[2]) + 1, nil
+	}
+	return 0, fmt.Errorf("unknown comp %s", comp)
+}
+
+// run executes at most steps instructions. It stops when the program counter leaves the ROM.
+func (c *cpu) run(steps int) {
+	for ; steps > 0 && 0 <= c.pc && c.pc < len(c.rom); steps-- {
+		inst := c.rom[c.pc]
+		if inst.isA {
+			c.a = inst.value
+			c.pc += 1
+			continue
+		}
+
+		v, _ := c.eval(inst.comp)
+		addr := uint16(c.a) & 0x7fff
+		target := int(uint16(c.a))
+		if strings.Contains(inst.dest, "M") {
+			c.ram[addr] = v
+		}
+		if strings.Contains(inst.dest, "A") {
+			c.a = v
+		}
+		if strings.Contains(inst.dest, "D") {
+			c.d = v
+		}
+
+		jump := false
+		switch inst.jump {
+		case "JGT":
+			jump = v > 0
+		case "JEQ":
+			jump = v == 0
+		case "JGE":
+			jump = v >= 0
+		case "JLT":
+			jump = v < 0
+		case "JNE":
+			jump = v != 0
+		case "JLE":
+			jump = v <= 0
+		case "JMP":
+			jump = true
+		}
+		if jump {
+			c.pc = target
+		} else {
+			c.pc += 1
+		}
+	}
+}
@@ -1,96 +1,240 @@
 package cmd
 
 import (
+	"bytes"
 	"fmt"
-	"log"
+	"io"
 	"os"
 	"path/filepath"
+	"sync"
 
 	"github.com/uu64/nand2tetris/vm/internal/codewriter"
+	"github.com/uu64/nand2tetris/vm/internal/emulator"
 	"github.com/uu64/nand2tetris/vm/internal/parser"
+	"github.com/uu64/nand2tetris/vm/internal/vm"
 )
 
+// Options selects the optional behavior of Cmd.
+type Options struct {
+	// DisableBootstrap omits the bootstrap code which calls Sys.init.
+	DisableBootstrap bool
+	// Compact jumps to shared routines for eq, gt, lt, call and return instead of inlining them.
+	Compact bool
+	// Optimize caches the stack top in D and fuses the commands which commonly appear in sequence into shorter code.
+	Optimize bool
+}
+
 type Cmd struct {
-	vmfilePaths      []string
-	asmfilePath      string
-	disableBootstrap bool
+	vmfilePaths []string
+	asmfilePath string
+	opts        Options
 }
 
-func New(vmfilePaths []string, asmfilePath string, disableBootstrap bool) *Cmd {
+// New returns a command which translates the vm files into asmfilePath.
+func New(vmfilePaths []string, asmfilePath string, opts Options) *Cmd {
 	return &Cmd{
-		vmfilePaths:      vmfilePaths,
-		asmfilePath:      asmfilePath,
-		disableBootstrap: disableBootstrap,
+		vmfilePaths: vmfilePaths,
+		asmfilePath: asmfilePath,
+		opts:        opts,
 	}
 }
 
-func parse(cw *codewriter.CodeWriter, asmfilePath string) error {
-	in, err := os.Open(asmfilePath)
+// write translates the command. The error is reported at the command.
+func write(cw *codewriter.CodeWriter, cmd vm.Command) *parser.Error {
+	var err error
+	switch cmd.Kind {
+	case vm.Arithmetic:
+		err = cw.WriteArithmetic(cmd.Op.String())
+	case vm.Push:
+		err = cw.WritePushPop(parser.C_PUSH, cmd.Segment.String(), cmd.Index)
+	case vm.Pop:
+		err = cw.WritePushPop(parser.C_POP, cmd.Segment.String(), cmd.Index)
+	case vm.Label:
+		err = cw.WriteLabel(cmd.Name)
+	case vm.Goto:
+		err = cw.WriteGoto(cmd.Name)
+	case vm.If:
+		err = cw.WriteIf(cmd.Name)
+	case vm.Function:
+		err = cw.WriteFunction(cmd.Name, cmd.N)
+	case vm.Call:
+		err = cw.WriteCall(cmd.Name, cmd.N)
+	case vm.Return:
+		err = cw.WriteReturn()
+	default:
+		err = fmt.Errorf("undefined command kind: %s", cmd.Kind)
+	}
 	if err != nil {
-		return err
+		return cmd.Errorf("%v", err)
 	}
-	defer in.Close()
-	p := parser.New(in)
+	return nil
+}
 
-	cw.SetFileName(filepath.Base(asmfilePath))
+// newCodeWriter returns a CodeWriter with the options.
+func newCodeWriter(w io.Writer, opts Options) *codewriter.CodeWriter {
+	cw := codewriter.New(w)
+	cw.Compact = opts.Compact
+	cw.Optimize = opts.Optimize
+	return cw
+}
 
-	for p.HasMoreCommands() {
-		if err := p.Advance(); err != nil {
-			return err
-		}
+// output is the asm of a file translated by its own CodeWriter.
+type output struct {
+	cw   *codewriter.CodeWriter
+	buf  bytes.Buffer
+	errs parser.ErrorList
+	err  error
+}
 
-		var err error
-		switch p.CommandType() {
-		case parser.C_ARITHMETRIC:
-			err = cw.WriteArithmetic(p.Arg1())
-		case parser.C_PUSH:
-			err = cw.WritePushPop(parser.C_PUSH, p.Arg1(), p.Arg2())
-		case parser.C_POP:
-			err = cw.WritePushPop(parser.C_POP, p.Arg1(), p.Arg2())
-		case parser.C_LABEL:
-			err = cw.WriteLabel(p.Arg1())
-		case parser.C_GOTO:
-			err = cw.WriteGoto(p.Arg1())
-		case parser.C_IF:
-			err = cw.WriteIf(p.Arg1())
-		case parser.C_FUNCTION:
-			err = cw.WriteFunction(p.Arg1(), p.Arg2())
-		case parser.C_CALL:
-			err = cw.WriteCall(p.Arg1(), p.Arg2())
-		case parser.C_RETURN:
-			err = cw.WriteReturn()
-		case parser.COMMENT, parser.EMPTY:
-			// do nothing
-		default:
-			err = fmt.Errorf("undefined command type: %d", p.CommandType())
+// translateFile translates the file into out.
+func translateFile(file *vm.File, opts Options, out *output) {
+	out.cw = newCodeWriter(&out.buf, opts)
+	if out.err = out.cw.SetFileName(filepath.Base(file.Path)); out.err != nil {
+		return
+	}
+	for _, cmd := range file.All() {
+		if err := write(out.cw, cmd); err != nil {
+			out.errs = append(out.errs, err)
 		}
-		if err != nil {
-			log.Fatal(err)
+	}
+	out.err = out.cw.Flush()
+}
+
+// translate translates the program into asm.
+// The files are translated concurrently, each by its own CodeWriter into its own buffer,
+// and concatenated in the order of the files, so the output is always the same.
+// If the program has errors, all of them are returned as a parser.ErrorList.
+func translate(prog *vm.Program, opts Options) (*bytes.Buffer, error) {
+	outputs := make([]output, len(prog.Files))
+	var wg sync.WaitGroup
+	for i, file := range prog.Files {
+		wg.Add(1)
+		go func(file *vm.File, out *output) {
+			defer wg.Done()
+			translateFile(file, opts, out)
+		}(file, &outputs[i])
+	}
+	wg.Wait()
+
+	var errs parser.ErrorList
+	for _, out := range outputs {
+		if out.err != nil {
+			return nil, out.err
 		}
+		errs = append(errs, out.errs...)
 	}
-	return nil
+	if err := errs.Err(); err != nil {
+		return nil, err
+	}
+
+	// the bootstrap code, the files and the shared routines used by any of them
+	buf := bytes.NewBuffer([]byte{})
+	cw := newCodeWriter(buf, opts)
+	if !opts.DisableBootstrap {
+		cw.WriteInit()
+	}
+	if err := cw.Flush(); err != nil {
+		return nil, err
+	}
+	for i := range outputs {
+		buf.Write(outputs[i].buf.Bytes())
+		cw.Use(outputs[i].cw)
+	}
+	if err := cw.Close(); err != nil {
+		return nil, err
+	}
+	return buf, nil
 }
 
-func (cmd *Cmd) Run() (err error) {
-	out, err := os.Create(cmd.asmfilePath)
+// load parses the vm files and checks the labels.
+// If the vm files have errors, all of them are returned as a parser.ErrorList.
+func (cmd *Cmd) load() (*vm.Program, error) {
+	prog, err := vm.ParseFiles(cmd.vmfilePaths)
+	if err != nil {
+		return nil, err
+	}
+	if err := prog.CheckLabels().Err(); err != nil {
+		return nil, err
+	}
+	return prog, nil
+}
+
+// Check analyzes the call graph of the vm files without translating them. The functions of the OS may be called
+// without including it. All problems are returned as a parser.ErrorList.
+func (cmd *Cmd) Check() error {
+	prog, err := cmd.load()
 	if err != nil {
 		return err
 	}
-	defer out.Close()
-	cw := codewriter.New(out)
+	return prog.Check(vm.OS).Err()
+}
 
-	if !cmd.disableBootstrap {
-		cw.WriteInit()
+// Emulate runs the vm files on the emulator from the entry function, which is called like the bootstrap code.
+// If entry is empty, the program runs from Sys.init if it is defined, or from the first command.
+// maxSteps limits the number of commands to run unless it is zero.
+func (cmd *Cmd) Emulate(entry string, maxSteps int) (*emulator.Machine, error) {
+	prog, err := cmd.load()
+	if err != nil {
+		return nil, err
+	}
+	m, err := emulator.New(prog)
+	if err != nil {
+		return nil, err
 	}
+	m.MaxSteps = maxSteps
 
-	for _, vmfilePath := range cmd.vmfilePaths {
-		if err := parse(cw, vmfilePath); err != nil {
-			return err
+	if _, _, ok := prog.Func(vm.SysInit); entry == "" && ok {
+		entry = vm.SysInit
+	}
+	if entry != "" {
+		if err := m.Boot(entry); err != nil {
+			return nil, err
 		}
 	}
+	return m, m.Run()
+}
 
-	if err := cw.Close(); err != nil {
+// countInstructions returns the number of instructions of the asm, which is the number of ROM words.
+func countInstructions(b []byte) int {
+	n := 0
+	for _, line := range bytes.Split(b, []byte("\n")) {
+		if len(line) > 0 && line[0] != '(' {
+			n += 1
+		}
+	}
+	return n
+}
+
+// Run translates the vm files into the asm file.
+// If the vm files have errors, all of them are returned as a parser.ErrorList and the asm file is not written.
+// With the bootstrap code, the functions which are never called from Sys.init are not translated,
+// so that a program linked with the whole OS fits in the ROM.
+// In the compact mode or the optimized mode, the size is reported with the size of the default output.
+func (cmd *Cmd) Run() (err error) {
+	prog, err := cmd.load()
+	if err != nil {
 		return err
 	}
-	return nil
+	if !cmd.opts.DisableBootstrap {
+		var removed int
+		prog, removed = prog.Shake(vm.SysInit)
+		if removed > 0 {
+			fmt.Printf("removed %d functions never called from %s\n", removed, vm.SysInit)
+		}
+	}
+	buf, err := translate(prog, cmd.opts)
+	if err != nil {
+		return err
+	}
+
+	if cmd.opts.Compact || cmd.opts.Optimize {
+		def, err := translate(prog, Options{DisableBootstrap: cmd.opts.DisableBootstrap})
+		if err != nil {
+			return err
+		}
+		size, defSize := countInstructions(buf.Bytes()), countInstructions(def.Bytes())
+		fmt.Printf("size: %d instructions (default: %d, saved %d)\n", size, defSize, defSize-size)
+	}
+
+	return os.WriteFile(cmd.asmfilePath, buf.Bytes(), 0644)
 }
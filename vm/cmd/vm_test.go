@@ -0,0 +1,317 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/uu64/nand2tetris/vm/internal/emulator"
+	"github.com/uu64/nand2tetris/vm/internal/vm"
+)
+
+// programs are the test programs of projects/07 and projects/08, which are the directories of the vm files.
+var programs = []string{
+	"07/StackArithmetic/SimpleAdd",
+	"07/StackArithmetic/StackTest",
+	"07/MemoryAccess/BasicTest",
+	"07/MemoryAccess/PointerTest",
+	"07/MemoryAccess/StaticTest",
+	"08/ProgramFlow/BasicLoop",
+	"08/ProgramFlow/FibonacciSeries",
+	"08/FunctionCalls/SimpleFunction",
+	"08/FunctionCalls/NestedCall",
+	"08/FunctionCalls/FibonacciElement",
+	"08/FunctionCalls/StaticsTest",
+}
+
+var (
+	setPattern    = regexp.MustCompile(`set RAM\[(\d+)\] (-?\d+)`)
+	repeatPattern = regexp.MustCompile(`repeat (\d+)`)
+	outputPattern = regexp.MustCompile(`(?s)output-list(.*?);`)
+	cellPattern   = regexp.MustCompile(`RAM\[(\d+)\]`)
+)
+
+// script is the part of a tst file which is used to run a program on cpu.
+type script struct {
+	ram     map[int]int16
+	steps   int
+	outputs []int
+}
+
+func readScript(t *testing.T, tstPath string) script {
+	t.Helper()
+	b, err := os.ReadFile(tstPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := string(b)
+
+	s := script{ram: map[int]int16{}}
+	for _, m := range setPattern.FindAllStringSubmatch(src, -1) {
+		addr, _ := strconv.Atoi(m[1])
+		v, _ := strconv.Atoi(m[2])
+		s.ram[addr] = int16(v)
+	}
+	m := repeatPattern.FindStringSubmatch(src)
+	if m == nil {
+		t.Fatalf("%s: no repeat", tstPath)
+	}
+	s.steps, _ = strconv.Atoi(m[1])
+	// a test may output several lists at the end
+	for _, m := range outputPattern.FindAllStringSubmatch(src, -1) {
+		for _, cell := range cellPattern.FindAllStringSubmatch(m[1], -1) {
+			addr, _ := strconv.Atoi(cell[1])
+			s.outputs = append(s.outputs, addr)
+		}
+	}
+	if len(s.outputs) == 0 {
+		t.Fatalf("%s: no output-list", tstPath)
+	}
+	return s
+}
+
+// readCmp returns the values of a cmp file, skipping the header lines.
+func readCmp(t *testing.T, cmpPath string) []int16 {
+	t.Helper()
+	b, err := os.ReadFile(cmpPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var values []int16
+	for _, line := range strings.Split(string(b), "\n") {
+		if strings.Contains(line, "RAM[") {
+			continue
+		}
+		for _, field := range strings.Split(line, "|") {
+			if field = strings.TrimSpace(field); field == "" {
+				continue
+			}
+			v, err := strconv.Atoi(field)
+			if err != nil {
+				t.Fatalf("%s: %v", cmpPath, err)
+			}
+			values = append(values, int16(v))
+		}
+	}
+	return values
+}
+
+// execute translates the program with opts and runs it as the tst file does.
+func execute(t *testing.T, dir string, s script, opts Options) []int16 {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join(dir, "*.vm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.DisableBootstrap = true
+	for _, path := range paths {
+		if filepath.Base(path) == "Sys.vm" {
+			opts.DisableBootstrap = false
+		}
+	}
+
+	prog, err := New(paths, "", opts).load()
+	if err != nil {
+		t.Fatalf("load() = %v", err)
+	}
+	buf, err := translate(prog, opts)
+	if err != nil {
+		t.Fatalf("translate() = %v", err)
+	}
+	c, err := newCPU(buf.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for addr, v := range s.ram {
+		c.ram[addr] = v
+	}
+	c.run(s.steps)
+
+	var values []int16
+	for _, addr := range s.outputs {
+		values = append(values, c.ram[addr])
+	}
+	return values
+}
+
+// TestOptimize runs the programs of projects/07 and projects/08 translated with and without the optimizations,
+// and compares the outputs with each other and with the cmp files.
+func TestOptimize(t *testing.T) {
+	modes := []struct {
+		name string
+		opts Options
+	}{
+		{name: "compact", opts: Options{Compact: true}},
+		{name: "optimize", opts: Options{Optimize: true}},
+		{name: "optimize-compact", opts: Options{Compact: true, Optimize: true}},
+	}
+
+	for _, prog := range programs {
+		dir := filepath.Join("..", "..", "projects", filepath.FromSlash(prog))
+		name := filepath.Base(dir)
+		s := readScript(t, filepath.Join(dir, name+".tst"))
+		want := readCmp(t, filepath.Join(dir, name+".cmp"))
+
+		t.Run(name, func(t *testing.T) {
+			def := execute(t, dir, s, Options{})
+			if !equal(def, want) {
+				t.Fatalf("default output = %v, want %v", def, want)
+			}
+			for _, mode := range modes {
+				if got := execute(t, dir, s, mode.opts); !equal(got, def) {
+					t.Errorf("%s output = %v, default output = %v", mode.name, got, def)
+				}
+			}
+		})
+	}
+}
+
+func equal(a, b []int16) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// TestDeterministic translates the OS many times, and checks that the output is always the same
+// and that each file is translated regardless of the other files.
+func TestDeterministic(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("..", "..", "tools", "OS", "*.vm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := Options{DisableBootstrap: true, Optimize: true}
+	prog, err := New(paths, "", opts).load()
+	if err != nil {
+		t.Fatalf("load() = %v", err)
+	}
+
+	want, err := translate(prog, opts)
+	if err != nil {
+		t.Fatalf("translate() = %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		got, err := translate(prog, opts)
+		if err != nil {
+			t.Fatalf("translate() = %v", err)
+		}
+		if !bytes.Equal(got.Bytes(), want.Bytes()) {
+			t.Fatalf("translate() #%d differs from the first output", i)
+		}
+	}
+
+	var concat bytes.Buffer
+	for _, file := range prog.Files {
+		buf, err := translate(&vm.Program{Files: []*vm.File{file}}, opts)
+		if err != nil {
+			t.Fatalf("translate() = %v", err)
+		}
+		concat.Write(buf.Bytes())
+	}
+	if !bytes.Equal(concat.Bytes(), want.Bytes()) {
+		t.Errorf("translate() differs from the files translated one by one")
+	}
+}
+
+// TestEmulate runs the programs of projects/07 and projects/08 on the emulator and compares the outputs with the cmp files.
+func TestEmulate(t *testing.T) {
+	for _, prog := range programs {
+		dir := filepath.Join("..", "..", "projects", filepath.FromSlash(prog))
+		name := filepath.Base(dir)
+		s := readScript(t, filepath.Join(dir, name+".tst"))
+		want := readCmp(t, filepath.Join(dir, name+".cmp"))
+
+		t.Run(name, func(t *testing.T) {
+			paths, err := filepath.Glob(filepath.Join(dir, "*.vm"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			p, err := New(paths, "", Options{}).load()
+			if err != nil {
+				t.Fatalf("load() = %v", err)
+			}
+			m, err := emulator.New(p)
+			if err != nil {
+				t.Fatalf("emulator.New() = %v", err)
+			}
+			for addr, v := range s.ram {
+				m.RAM[addr] = v
+			}
+			if _, _, ok := p.Func(vm.SysInit); ok {
+				if err := m.Boot(vm.SysInit); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// a command takes more than one CPU instruction
+			m.MaxSteps = s.steps
+			if err := m.Run(); err != nil {
+				t.Fatalf("Run() = %v after %d steps", err, m.Steps)
+			}
+
+			var got []int16
+			for _, addr := range s.outputs {
+				got = append(got, m.RAM[addr])
+			}
+			if !equal(got, want) {
+				t.Errorf("output = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+// TestCache runs a program with Math, Memory and Array of the OS, translated with and without the optimizations,
+// and compares the return value of Main.main with the emulator.
+func TestCache(t *testing.T) {
+	paths := []string{filepath.Join("testdata", "Cache", "Sys.vm"), filepath.Join("testdata", "Cache", "Main.vm")}
+	for _, name := range []string{"Array", "Math", "Memory"} {
+		paths = append(paths, filepath.Join("..", "..", "tools", "OS", name+".vm"))
+	}
+	prog, err := New(paths, "", Options{}).load()
+	if err != nil {
+		t.Fatalf("load() = %v", err)
+	}
+
+	m, err := emulator.New(prog)
+	if err != nil {
+		t.Fatalf("emulator.New() = %v", err)
+	}
+	if err := m.Boot(vm.SysInit); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Run(); err != nil {
+		t.Fatalf("Run() = %v", err)
+	}
+	// temp 0, which is computed as follows
+	//
+	//	local 1 = 285, local 6 = -3000/7 + sqrt(1000) = -397, local 3 = 1+2+3-4-397*2 = -792
+	//	temp 1 = -1, temp 2 = 2
+	//	(285 - -397 + -1 | 2) + (-792 & !-3000) = 683 + (-792 & 2999) = 683 + 2208
+	want := m.RAM[5]
+	if want != 2891 {
+		t.Fatalf("emulator: Main.main() = %d, want 2891", want)
+	}
+
+	for _, opts := range []Options{{}, {Compact: true}, {Optimize: true}, {Compact: true, Optimize: true}} {
+		buf, err := translate(prog, opts)
+		if err != nil {
+			t.Fatalf("translate() = %v", err)
+		}
+		c, err := newCPU(buf.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.run(1000000)
+		if got := c.ram[5]; got != want {
+			t.Errorf("%+v: Main.main() = %d, want %d", opts, got, want)
+		}
+	}
+}
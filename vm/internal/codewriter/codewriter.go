@@ -11,10 +11,23 @@ import (
 )
 
 type CodeWriter struct {
+	// Compact writes eq, gt, lt, call and return as jumps to shared routines
+	// instead of inlining them at every command. The routines are written by Close.
+	Compact bool
+	// Optimize caches the stack top in D across the commands, and fuses the commands which commonly
+	// appear in sequence, such as a comparison and if-goto, into shorter code.
+	// The commands are buffered and the rest are written by Close.
+	Optimize bool
+
 	writer        *bufio.Writer
 	inputFileName string
 	functionName  string
 	counter       int
+	routines      map[string]bool
+	pending       []command
+	flushing      bool
+	// cached is true if the stack top is in D instead of the memory, which SP does not count
+	cached bool
 }
 
 func New(f io.Writer) *CodeWriter {
@@ -23,6 +36,7 @@ func New(f io.Writer) *CodeWriter {
 		inputFileName: "",
 		functionName:  "",
 		counter:       0,
+		routines:      map[string]bool{},
 	}
 }
 
@@ -34,11 +48,42 @@ func (cw *CodeWriter) WriteInit() {
 	cw.WriteCall("Sys.init", 0)
 }
 
-func (cw *CodeWriter) SetFileName(name string) {
+// SetFileName starts a new vm file, which is outside any function until WriteFunction.
+// The buffered commands of the previous file are written, and the counter of the labels is reset,
+// so that the labels of a file do not depend on the other files.
+func (cw *CodeWriter) SetFileName(name string) error {
+	if err := cw.flush(); err != nil {
+		return err
+	}
 	cw.inputFileName = name
+	cw.functionName = ""
+	cw.counter = 0
+	return nil
+}
+
+// Flush writes the buffered commands and flushes the output without the shared routines,
+// which are written by Close of the CodeWriter which uses them (see Use).
+func (cw *CodeWriter) Flush() error {
+	if err := cw.flush(); err != nil {
+		return err
+	}
+	return cw.writer.Flush()
+}
+
+// Use marks the shared routines used by other as used, so that Close writes them.
+// It is used when the files are translated by their own CodeWriters.
+func (cw *CodeWriter) Use(other *CodeWriter) {
+	for routine := range other.routines {
+		cw.routines[routine] = true
+	}
 }
 
+// Close writes the buffered commands and the shared routines used in the compact mode, and flushes the output.
 func (cw *CodeWriter) Close() error {
+	if err := cw.flush(); err != nil {
+		return err
+	}
+	cw.writeRoutines()
 	if err := cw.writer.Flush(); err != nil {
 		return err
 	}
@@ -46,12 +91,24 @@ func (cw *CodeWriter) Close() error {
 }
 
 func (cw *CodeWriter) WriteArithmetic(cmd string) error {
+	if cw.buffering() {
+		switch cmd {
+		case parser.CMD_ADD, parser.CMD_SUB, parser.CMD_NEG, parser.CMD_EQ, parser.CMD_GT, parser.CMD_LT, parser.CMD_AND, parser.CMD_OR, parser.CMD_NOT:
+			return cw.enqueue(parser.C_ARITHMETRIC, cmd, 0)
+		}
+		return fmt.Errorf("undefined operator: %s", cmd)
+	}
+
 	switch cmd {
 	case parser.CMD_ADD, parser.CMD_SUB, parser.CMD_AND, parser.CMD_OR:
 		cw.binary(cmd)
 	case parser.CMD_NEG, parser.CMD_NOT:
 		cw.unary(cmd)
 	case parser.CMD_EQ, parser.CMD_GT, parser.CMD_LT:
+		if cw.Compact {
+			cw.callRoutine(cmd)
+			break
+		}
 		cw.cond(cmd)
 	default:
 		return fmt.Errorf("undefined operator: %s", cmd)
@@ -126,7 +183,10 @@ func (cw *CodeWriter) cond(cmd string) error {
 
 	// compare
 	cw.writer.WriteString("D=M-D\n")
-	cw.writer.WriteString(fmt.Sprintf("@%s%d_T\n", id, cw.counter))
+	labelT := cw.unique(fmt.Sprintf("%s%d_T", id, cw.counter))
+	labelF := cw.unique(fmt.Sprintf("%s%d_F", id, cw.counter))
+	labelEnd := cw.unique(fmt.Sprintf("%s%d_END", id, cw.counter))
+	cw.writer.WriteString(fmt.Sprintf("@%s\n", labelT))
 	switch cmd {
 	case parser.CMD_EQ:
 		cw.writer.WriteString("D;JEQ\n")
@@ -137,21 +197,21 @@ func (cw *CodeWriter) cond(cmd string) error {
 	default:
 		return fmt.Errorf("undefined operator: %s", cmd)
 	}
-	cw.writer.WriteString(fmt.Sprintf("@%s%d_F\n", id, cw.counter))
+	cw.writer.WriteString(fmt.Sprintf("@%s\n", labelF))
 	cw.writer.WriteString("0;JMP\n")
 
 	// set true or false
-	cw.writer.WriteString(fmt.Sprintf("(%s%d_T)\n", id, cw.counter))
+	cw.writer.WriteString(fmt.Sprintf("(%s)\n", labelT))
 	cw.writer.WriteString("D=-1\n")
-	cw.writer.WriteString(fmt.Sprintf("@%s%d_END\n", id, cw.counter))
+	cw.writer.WriteString(fmt.Sprintf("@%s\n", labelEnd))
 	cw.writer.WriteString("0;JMP\n")
-	cw.writer.WriteString(fmt.Sprintf("(%s%d_F)\n", id, cw.counter))
+	cw.writer.WriteString(fmt.Sprintf("(%s)\n", labelF))
 	cw.writer.WriteString("D=0\n")
-	cw.writer.WriteString(fmt.Sprintf("@%s%d_END\n", id, cw.counter))
+	cw.writer.WriteString(fmt.Sprintf("@%s\n", labelEnd))
 	cw.writer.WriteString("0;JMP\n")
 
 	// update stack with the result
-	cw.writer.WriteString(fmt.Sprintf("(%s%d_END)\n", id, cw.counter))
+	cw.writer.WriteString(fmt.Sprintf("(%s)\n", labelEnd))
 	cw.writer.WriteString("@SP\n")
 	cw.writer.WriteString("A=M\n")
 	cw.writer.WriteString("M=D\n")
@@ -163,6 +223,16 @@ func (cw *CodeWriter) cond(cmd string) error {
 }
 
 func (cw *CodeWriter) WritePushPop(cmd parser.CmdType, segment string, index int) error {
+	if cw.buffering() {
+		if _, ok := memSegMap[segment]; !ok && segment != parser.SEG_CONST && segment != parser.SEG_STATIC {
+			return fmt.Errorf("undefined segment: %s", segment)
+		}
+		if cmd != parser.C_PUSH && cmd != parser.C_POP {
+			return fmt.Errorf("invalid operation: %d", cmd)
+		}
+		return cw.enqueue(cmd, segment, index)
+	}
+
 	switch cmd {
 	case parser.C_PUSH:
 		return cw.writePush(segment, index)
@@ -184,6 +254,21 @@ var memSegMap = map[string]string{
 
 // writePush outputs the asm code to push a value to a specific segment.
 func (cw *CodeWriter) writePush(segment string, index int) error {
+	if err := cw.load(segment, index); err != nil {
+		return err
+	}
+
+	cw.writer.WriteString("@SP\n")
+	cw.writer.WriteString("A=M\n")
+	cw.writer.WriteString("M=D\n")
+	cw.writer.WriteString("@SP\n")
+	cw.writer.WriteString("M=M+1\n")
+
+	return nil
+}
+
+// load outputs the asm code to set D to the value of a specific segment.
+func (cw *CodeWriter) load(segment string, index int) error {
 	switch segment {
 	case parser.SEG_CONST:
 		cw.writer.WriteString(fmt.Sprintf("@%d\n", index))
@@ -201,20 +286,41 @@ func (cw *CodeWriter) writePush(segment string, index int) error {
 		cw.writer.WriteString("A=D+A\n")
 		cw.writer.WriteString("D=M\n")
 	case parser.SEG_STATIC:
-		ns := strings.TrimSuffix(cw.inputFileName, filepath.Ext(cw.inputFileName))
-		cw.writer.WriteString(fmt.Sprintf("@%s.%d\n", ns, index))
+		cw.writer.WriteString(fmt.Sprintf("@%s\n", cw.static(index)))
 		cw.writer.WriteString("D=M\n")
 	default:
 		return fmt.Errorf("undefined segment: %s", segment)
 	}
+	return nil
+}
 
-	cw.writer.WriteString("@SP\n")
-	cw.writer.WriteString("A=M\n")
-	cw.writer.WriteString("M=D\n")
-	cw.writer.WriteString("@SP\n")
-	cw.writer.WriteString("M=M+1\n")
+// static returns the symbol of a variable of the static segment of the current file.
+func (cw *CodeWriter) static(index int) string {
+	return fmt.Sprintf("%s.%d", cw.fileNamespace(), index)
+}
 
-	return nil
+func (cw *CodeWriter) fileNamespace() string {
+	return strings.TrimSuffix(cw.inputFileName, filepath.Ext(cw.inputFileName))
+}
+
+// unique returns a label generated for a command, such as Main:IF3 for IF3 in Main.vm.
+// The counter is per file, so the file name makes it unique in the output.
+// It never collides with the labels of the vm commands, which have a dollar sign, nor the functions named Class.method.
+func (cw *CodeWriter) unique(label string) string {
+	if ns := cw.fileNamespace(); ns != "" {
+		return ns + ":" + label
+	}
+	return label
+}
+
+// label returns the symbol of a label of the current function, such as Main.main$LOOP,
+// so that the functions may use the same labels.
+// A label outside any function belongs to the file, such as Main$LOOP.
+func (cw *CodeWriter) label(label string) string {
+	if cw.functionName == "" {
+		return fmt.Sprintf("%s$%s", cw.fileNamespace(), label)
+	}
+	return fmt.Sprintf("%s$%s", cw.functionName, label)
 }
 
 // writePop outputs the asm code to pop a value from a specific segment.
@@ -226,7 +332,27 @@ func (cw *CodeWriter) writePop(segment string, index int) error {
 		return nil
 	}
 
-	// calculate address
+	if err := cw.address(segment, index); err != nil {
+		return err
+	}
+
+	// save address
+	cw.writer.WriteString("@R13\n")
+	cw.writer.WriteString("M=D\n")
+
+	// update the stack and the segment
+	cw.writer.WriteString("@SP\n")
+	cw.writer.WriteString("AM=M-1\n")
+	cw.writer.WriteString("D=M\n")
+	cw.writer.WriteString("@R13\n")
+	cw.writer.WriteString("A=M\n")
+	cw.writer.WriteString("M=D\n")
+
+	return nil
+}
+
+// address outputs the asm code to set D to the address of a specific segment.
+func (cw *CodeWriter) address(segment string, index int) error {
 	switch segment {
 	case parser.SEG_LOCAL, parser.SEG_ARG, parser.SEG_THIS, parser.SEG_THAT:
 		cw.writer.WriteString(fmt.Sprintf("@%s\n", memSegMap[segment]))
@@ -239,61 +365,89 @@ func (cw *CodeWriter) writePop(segment string, index int) error {
 		cw.writer.WriteString(fmt.Sprintf("@%d\n", index))
 		cw.writer.WriteString("D=D+A\n")
 	case parser.SEG_STATIC:
-		ns := strings.TrimSuffix(cw.inputFileName, filepath.Ext(cw.inputFileName))
-		cw.writer.WriteString(fmt.Sprintf("@%s.%d\n", ns, index))
+		cw.writer.WriteString(fmt.Sprintf("@%s\n", cw.static(index)))
 		cw.writer.WriteString("D=A\n")
 	default:
 		return fmt.Errorf("undefined segment: %s", segment)
 	}
-
-	// save address
-	cw.writer.WriteString("@R13\n")
-	cw.writer.WriteString("M=D\n")
-
-	// update the stack and the segment
-	cw.writer.WriteString("@SP\n")
-	cw.writer.WriteString("AM=M-1\n")
-	cw.writer.WriteString("D=M\n")
-	cw.writer.WriteString("@R13\n")
-	cw.writer.WriteString("A=M\n")
-	cw.writer.WriteString("M=D\n")
-
 	return nil
 }
 
 func (cw *CodeWriter) WriteLabel(label string) error {
-	cw.writer.WriteString(fmt.Sprintf("(%s)\n", label))
+	if cw.buffering() {
+		return cw.enqueue(parser.C_LABEL, label, 0)
+	}
+
+	cw.writer.WriteString(fmt.Sprintf("(%s)\n", cw.label(label)))
 	return nil
 }
 
 func (cw *CodeWriter) WriteGoto(label string) error {
+	if cw.buffering() {
+		return cw.enqueue(parser.C_GOTO, label, 0)
+	}
+
+	cw.jump(cw.label(label))
+	return nil
+}
+
+// jump writes an unconditional jump, which is never buffered.
+func (cw *CodeWriter) jump(label string) {
 	cw.writer.WriteString(fmt.Sprintf("@%s\n", label))
 	cw.writer.WriteString("0;JMP\n")
-	return nil
 }
 
 func (cw *CodeWriter) WriteIf(label string) error {
+	if cw.buffering() {
+		return cw.enqueue(parser.C_IF, label, 0)
+	}
+
 	// this code is same as the code to pop from a constant segment
 	cw.writer.WriteString("@SP\n")
 	cw.writer.WriteString("AM=M-1\n")
 	cw.writer.WriteString("D=M\n")
 
 	// if M=0, do nothing
-	cw.writer.WriteString(fmt.Sprintf("@IF%d\n", cw.counter))
+	skip := cw.unique(fmt.Sprintf("IF%d", cw.counter))
+	cw.writer.WriteString(fmt.Sprintf("@%s\n", skip))
 	cw.writer.WriteString("D;JEQ\n")
 
 	// if M!=0, jump to label
-	cw.writer.WriteString(fmt.Sprintf("@%s\n", label))
+	cw.writer.WriteString(fmt.Sprintf("@%s\n", cw.label(label)))
 	cw.writer.WriteString("0;JMP\n")
 
-	cw.writer.WriteString(fmt.Sprintf("(IF%d)\n", cw.counter))
+	cw.writer.WriteString(fmt.Sprintf("(%s)\n", skip))
 
 	cw.counter += 1
 	return nil
 }
 
 func (cw *CodeWriter) WriteCall(functionName string, numArgs int) error {
-	retAddr := fmt.Sprintf("%d.RET_ADDR", cw.counter)
+	if cw.buffering() {
+		return cw.enqueue(parser.C_CALL, functionName, numArgs)
+	}
+
+	retAddr := cw.unique(fmt.Sprintf("%d.RET_ADDR", cw.counter))
+
+	if cw.Compact {
+		// R13 = numArgs, R14 = f, D = return-addr
+		cw.writer.WriteString(fmt.Sprintf("@%d\n", numArgs))
+		cw.writer.WriteString("D=A\n")
+		cw.writer.WriteString("@R13\n")
+		cw.writer.WriteString("M=D\n")
+		cw.writer.WriteString(fmt.Sprintf("@%s\n", functionName))
+		cw.writer.WriteString("D=A\n")
+		cw.writer.WriteString("@R14\n")
+		cw.writer.WriteString("M=D\n")
+		cw.writer.WriteString(fmt.Sprintf("@%s\n", retAddr))
+		cw.writer.WriteString("D=A\n")
+		cw.routines[routineCall] = true
+		cw.jump(routineCall)
+		cw.writer.WriteString(fmt.Sprintf("(%s)\n", retAddr))
+
+		cw.counter += 1
+		return nil
+	}
 
 	pushAddr := func(addr string) {
 		cw.writer.WriteString(fmt.Sprintf("@%s\n", addr))
@@ -340,7 +494,7 @@ func (cw *CodeWriter) WriteCall(functionName string, numArgs int) error {
 	cw.writer.WriteString("M=D\n")
 
 	// goto f
-	cw.WriteGoto(functionName)
+	cw.jump(functionName)
 
 	// (return-address)
 	cw.writer.WriteString(fmt.Sprintf("(%s)\n", retAddr))
@@ -350,6 +504,20 @@ func (cw *CodeWriter) WriteCall(functionName string, numArgs int) error {
 }
 
 func (cw *CodeWriter) WriteReturn() error {
+	if cw.buffering() {
+		return cw.enqueue(parser.C_RETURN, "", 0)
+	}
+
+	if cw.Compact {
+		cw.routines[routineReturn] = true
+		cw.jump(routineReturn)
+		return nil
+	}
+	cw.writeReturn()
+	return nil
+}
+
+func (cw *CodeWriter) writeReturn() {
 	// FRAME = LCL
 	cw.writer.WriteString("@LCL\n")
 	cw.writer.WriteString("D=M\n")
@@ -391,10 +559,14 @@ func (cw *CodeWriter) WriteReturn() error {
 	cw.writer.WriteString("@R13\n")
 	cw.writer.WriteString("A=M\n")
 	cw.writer.WriteString("0;JMP\n")
-	return nil
 }
 
 func (cw *CodeWriter) WriteFunction(functionName string, numLocals int) error {
+	cw.functionName = functionName
+	if cw.buffering() {
+		return cw.enqueue(parser.C_FUNCTION, functionName, numLocals)
+	}
+
 	cw.writer.WriteString(fmt.Sprintf("(%s)\n", functionName))
 	for i := 0; i < numLocals; i++ {
 		cw.writePush(parser.SEG_CONST, 0)
@@ -0,0 +1,362 @@
+package codewriter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/uu64/nand2tetris/vm/internal/parser"
+)
+
+// window is the number of commands the optimizer looks at, which is the length of the longest pattern.
+const window = 3
+
+// fixedBase is the base address of the segments which are mapped to fixed addresses.
+var fixedBase = map[string]int{
+	parser.SEG_PTR:  3,
+	parser.SEG_TEMP: 5,
+}
+
+// command is a VM command buffered by the optimizer.
+type command struct {
+	cmdType parser.CmdType
+	arg1    string
+	arg2    int
+	// file and function are where the command is, which name the static variables and the labels
+	file     string
+	function string
+}
+
+func (c command) isArithmetic(ops ...string) bool {
+	if c.cmdType != parser.C_ARITHMETRIC {
+		return false
+	}
+	for _, op := range ops {
+		if c.arg1 == op {
+			return true
+		}
+	}
+	return false
+}
+
+// buffering reports whether a command is buffered instead of being written.
+func (cw *CodeWriter) buffering() bool {
+	return cw.Optimize && !cw.flushing
+}
+
+// enqueue buffers a command, and writes the commands which can no longer be a part of a pattern.
+func (cw *CodeWriter) enqueue(cmdType parser.CmdType, arg1 string, arg2 int) error {
+	cw.pending = append(cw.pending, command{cmdType: cmdType, arg1: arg1, arg2: arg2, file: cw.inputFileName, function: cw.functionName})
+	for len(cw.pending) >= window {
+		if err := cw.emit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flush writes all buffered commands, and stores the stack top cached in D.
+func (cw *CodeWriter) flush() error {
+	for len(cw.pending) > 0 {
+		if err := cw.emit(); err != nil {
+			return err
+		}
+	}
+	cw.spill()
+	return nil
+}
+
+// emit writes the first buffered command, or the first commands fused into a pattern.
+//
+// The stack top is cached in D: push and the commands which compute a value leave it in D instead of the stack,
+// and the next command takes it from D. For example, push x, pop y moves x through D,
+// and not, if-goto jumps on D without storing the condition.
+// The cache is stored to the stack before label, goto, function, call and return, where the stack must be in memory,
+// and at the end of the buffered commands.
+//
+// Some sequences are fused into shorter code than with the cache alone:
+//
+//	push x, add (sub, and, or)    computes D with x as an operand of the C command
+//	push x, eq (gt, lt)           compares D with x as an operand of the C command
+//	push x, eq (gt, lt), if-goto  jumps on the comparison with x
+//	eq (gt, lt), if-goto          jumps on the comparison
+//	eq (gt, lt), not, if-goto     jumps on the inverted comparison
+func (cw *CodeWriter) emit() (err error) {
+	cmds := cw.pending
+	n := 1
+	defer func() {
+		cw.pending = cw.pending[n:]
+	}()
+
+	// the static segment and the labels belong to the file and the function where the command is
+	file, function := cw.inputFileName, cw.functionName
+	cw.inputFileName, cw.functionName = cmds[0].file, cmds[0].function
+	cw.flushing = true
+	defer func() {
+		cw.inputFileName, cw.functionName = file, function
+		cw.flushing = false
+	}()
+
+	c := cmds[0]
+	next := func(i int) command {
+		if i < len(cmds) {
+			return cmds[i]
+		}
+		return command{cmdType: parser.EMPTY}
+	}
+
+	switch {
+	case c.cmdType == parser.C_PUSH && next(1).isArithmetic(parser.CMD_ADD, parser.CMD_SUB, parser.CMD_AND, parser.CMD_OR, parser.CMD_EQ, parser.CMD_GT, parser.CMD_LT):
+		// the operand must be addressed without D, which has the stack top
+		if !cw.addressable(c.arg1, c.arg2) {
+			break
+		}
+		op := next(1).arg1
+		cw.top()
+		operand := "1"
+		if c.arg1 != parser.SEG_CONST || c.arg2 != 1 || op == parser.CMD_AND || op == parser.CMD_OR {
+			operand = cw.operand(c.arg1, c.arg2)
+		}
+		switch op {
+		case parser.CMD_ADD:
+			cw.writer.WriteString(fmt.Sprintf("D=D+%s\n", operand))
+		case parser.CMD_SUB:
+			cw.writer.WriteString(fmt.Sprintf("D=D-%s\n", operand))
+		case parser.CMD_AND:
+			cw.writer.WriteString(fmt.Sprintf("D=D&%s\n", operand))
+		case parser.CMD_OR:
+			cw.writer.WriteString(fmt.Sprintf("D=D|%s\n", operand))
+		default:
+			cw.writer.WriteString(fmt.Sprintf("D=D-%s\n", operand))
+			if next(2).cmdType == parser.C_IF {
+				n = 3
+				cw.jumpOn(op, false, next(2).arg1)
+				return nil
+			}
+			cw.boolean(op)
+		}
+		n = 2
+		return nil
+	case c.isArithmetic(parser.CMD_EQ, parser.CMD_GT, parser.CMD_LT) && next(1).isArithmetic(parser.CMD_NOT) && next(2).cmdType == parser.C_IF:
+		n = 3
+		cw.compare()
+		cw.jumpOn(c.arg1, true, next(2).arg1)
+		return nil
+	case c.isArithmetic(parser.CMD_EQ, parser.CMD_GT, parser.CMD_LT) && next(1).cmdType == parser.C_IF:
+		n = 2
+		cw.compare()
+		cw.jumpOn(c.arg1, false, next(1).arg1)
+		return nil
+	}
+	return cw.cache(c)
+}
+
+// cache writes a command with the stack top cached in D.
+func (cw *CodeWriter) cache(c command) error {
+	switch c.cmdType {
+	case parser.C_PUSH:
+		cw.spill()
+		if err := cw.load(c.arg1, c.arg2); err != nil {
+			return err
+		}
+		cw.cached = true
+		return nil
+	case parser.C_POP:
+		cw.top()
+		cw.cached = false
+		return cw.store(c.arg1, c.arg2)
+	case parser.C_IF:
+		cw.top()
+		cw.cached = false
+		cw.writer.WriteString(fmt.Sprintf("@%s\n", cw.label(c.arg1)))
+		cw.writer.WriteString("D;JNE\n")
+		return nil
+	case parser.C_ARITHMETRIC:
+		if c.isArithmetic(parser.CMD_EQ, parser.CMD_GT, parser.CMD_LT) && cw.Compact {
+			// the shared routine takes the operands from the stack
+			break
+		}
+		cw.top()
+		switch c.arg1 {
+		case parser.CMD_NEG:
+			cw.writer.WriteString("D=-D\n")
+		case parser.CMD_NOT:
+			cw.writer.WriteString("D=!D\n")
+		case parser.CMD_ADD:
+			cw.writer.WriteString("@SP\n")
+			cw.writer.WriteString("AM=M-1\n")
+			cw.writer.WriteString("D=D+M\n")
+		case parser.CMD_SUB:
+			cw.writer.WriteString("@SP\n")
+			cw.writer.WriteString("AM=M-1\n")
+			cw.writer.WriteString("D=M-D\n")
+		case parser.CMD_AND:
+			cw.writer.WriteString("@SP\n")
+			cw.writer.WriteString("AM=M-1\n")
+			cw.writer.WriteString("D=D&M\n")
+		case parser.CMD_OR:
+			cw.writer.WriteString("@SP\n")
+			cw.writer.WriteString("AM=M-1\n")
+			cw.writer.WriteString("D=D|M\n")
+		case parser.CMD_EQ, parser.CMD_GT, parser.CMD_LT:
+			cw.compare()
+			cw.boolean(c.arg1)
+		default:
+			return fmt.Errorf("undefined operator: %s", c.arg1)
+		}
+		return nil
+	}
+	cw.spill()
+	return cw.write(c)
+}
+
+// write writes a command as it is.
+func (cw *CodeWriter) write(c command) error {
+	switch c.cmdType {
+	case parser.C_ARITHMETRIC:
+		return cw.WriteArithmetic(c.arg1)
+	case parser.C_PUSH, parser.C_POP:
+		return cw.WritePushPop(c.cmdType, c.arg1, c.arg2)
+	case parser.C_LABEL:
+		return cw.WriteLabel(c.arg1)
+	case parser.C_GOTO:
+		return cw.WriteGoto(c.arg1)
+	case parser.C_IF:
+		return cw.WriteIf(c.arg1)
+	case parser.C_FUNCTION:
+		return cw.WriteFunction(c.arg1, c.arg2)
+	case parser.C_CALL:
+		return cw.WriteCall(c.arg1, c.arg2)
+	case parser.C_RETURN:
+		return cw.WriteReturn()
+	}
+	return fmt.Errorf("undefined command type: %d", c.cmdType)
+}
+
+// top sets D to the stack top, popping it from the stack unless it is cached.
+func (cw *CodeWriter) top() {
+	if cw.cached {
+		return
+	}
+	cw.writer.WriteString("@SP\n")
+	cw.writer.WriteString("AM=M-1\n")
+	cw.writer.WriteString("D=M\n")
+	cw.cached = true
+}
+
+// spill pushes the stack top cached in D to the stack.
+func (cw *CodeWriter) spill() {
+	if !cw.cached {
+		return
+	}
+	cw.writer.WriteString("@SP\n")
+	cw.writer.WriteString("M=M+1\n")
+	cw.writer.WriteString("A=M-1\n")
+	cw.writer.WriteString("M=D\n")
+	cw.cached = false
+}
+
+// maxOffset is the largest index of local, argument, this and that which is addressed by incrementing A,
+// which takes an instruction for each.
+const maxOffset = 3
+
+// addressable reports whether a push operand can be addressed by A alone.
+func (cw *CodeWriter) addressable(segment string, index int) bool {
+	switch segment {
+	case parser.SEG_LOCAL, parser.SEG_ARG, parser.SEG_THIS, parser.SEG_THAT:
+		return index <= maxOffset
+	case parser.SEG_CONST, parser.SEG_STATIC, parser.SEG_PTR, parser.SEG_TEMP:
+		return true
+	}
+	return false
+}
+
+// operand writes the code to address an addressable operand without D,
+// and returns the register which has its value, which is A for a constant and M otherwise.
+func (cw *CodeWriter) operand(segment string, index int) string {
+	switch segment {
+	case parser.SEG_CONST:
+		cw.writer.WriteString(fmt.Sprintf("@%d\n", index))
+		return "A"
+	case parser.SEG_STATIC:
+		cw.writer.WriteString(fmt.Sprintf("@%s\n", cw.static(index)))
+	case parser.SEG_PTR, parser.SEG_TEMP:
+		cw.writer.WriteString(fmt.Sprintf("@%d\n", fixedBase[segment]+index))
+	default:
+		cw.writer.WriteString(fmt.Sprintf("@%s\n", memSegMap[segment]))
+		cw.writer.WriteString("A=M\n")
+		for i := 0; i < index; i++ {
+			cw.writer.WriteString("A=A+1\n")
+		}
+	}
+	return "M"
+}
+
+// store writes D to the segment.
+func (cw *CodeWriter) store(segment string, index int) error {
+	if segment == parser.SEG_CONST {
+		// the value is discarded as writePop does
+		return nil
+	}
+	if cw.addressable(segment, index) {
+		cw.operand(segment, index)
+		cw.writer.WriteString("M=D\n")
+		return nil
+	}
+
+	// save the value, and compute the address in D
+	cw.writer.WriteString("@R13\n")
+	cw.writer.WriteString("M=D\n")
+	if err := cw.address(segment, index); err != nil {
+		return err
+	}
+	cw.writer.WriteString("@R14\n")
+	cw.writer.WriteString("M=D\n")
+	cw.writer.WriteString("@R13\n")
+	cw.writer.WriteString("D=M\n")
+	cw.writer.WriteString("@R14\n")
+	cw.writer.WriteString("A=M\n")
+	cw.writer.WriteString("M=D\n")
+	return nil
+}
+
+// compare sets D to x-y of the comparison, where y is the stack top and x is under it.
+func (cw *CodeWriter) compare() {
+	cw.top()
+	cw.writer.WriteString("@SP\n")
+	cw.writer.WriteString("AM=M-1\n")
+	cw.writer.WriteString("D=M-D\n")
+}
+
+// boolean sets D to true (-1) or false (0) of the comparison of D, which is x-y.
+func (cw *CodeWriter) boolean(op string) {
+	id := strings.ToUpper(op)
+	labelT := cw.unique(fmt.Sprintf("%s%d_T", id, cw.counter))
+	labelEnd := cw.unique(fmt.Sprintf("%s%d_END", id, cw.counter))
+	cw.writer.WriteString(fmt.Sprintf("@%s\n", labelT))
+	cw.writer.WriteString(fmt.Sprintf("D;%s\n", jumps[op][0]))
+	cw.writer.WriteString("D=0\n")
+	cw.writer.WriteString(fmt.Sprintf("@%s\n", labelEnd))
+	cw.writer.WriteString("0;JMP\n")
+	cw.writer.WriteString(fmt.Sprintf("(%s)\n", labelT))
+	cw.writer.WriteString("D=-1\n")
+	cw.writer.WriteString(fmt.Sprintf("(%s)\n", labelEnd))
+	cw.counter += 1
+}
+
+// jumps maps a comparison to the jump on it and the jump on its inversion.
+var jumps = map[string][2]string{
+	parser.CMD_EQ: {"JEQ", "JNE"},
+	parser.CMD_GT: {"JGT", "JLE"},
+	parser.CMD_LT: {"JLT", "JGE"},
+}
+
+// jumpOn writes if-goto after a comparison, which jumps on D = x-y without pushing the result.
+func (cw *CodeWriter) jumpOn(op string, invert bool, label string) {
+	jump := jumps[op][0]
+	if invert {
+		jump = jumps[op][1]
+	}
+	cw.writer.WriteString(fmt.Sprintf("@%s\n", cw.label(label)))
+	cw.writer.WriteString(fmt.Sprintf("D;%s\n", jump))
+	cw.cached = false
+}
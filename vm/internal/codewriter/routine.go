@@ -0,0 +1,137 @@
+package codewriter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/uu64/nand2tetris/vm/internal/parser"
+)
+
+// The labels of the shared routines of the compact mode.
+// They have no dot, so they never collide with the functions named Class.method.
+const (
+	routineCall   = "VM$CALL"
+	routineReturn = "VM$RETURN"
+	routineHalt   = "VM$HALT"
+)
+
+// routineCond returns the label of the shared routine of eq, gt or lt.
+func routineCond(cmd string) string {
+	return "VM$" + strings.ToUpper(cmd)
+}
+
+// callRoutine writes a jump to the shared routine of eq, gt or lt, which returns to the next command.
+// The return address is passed in D.
+func (cw *CodeWriter) callRoutine(cmd string) {
+	retAddr := cw.unique(fmt.Sprintf("%s%d_RET", strings.ToUpper(cmd), cw.counter))
+	cw.writer.WriteString(fmt.Sprintf("@%s\n", retAddr))
+	cw.writer.WriteString("D=A\n")
+	cw.routines[routineCond(cmd)] = true
+	cw.jump(routineCond(cmd))
+	cw.writer.WriteString(fmt.Sprintf("(%s)\n", retAddr))
+
+	cw.counter += 1
+}
+
+// writeRoutines writes the shared routines which are used.
+// They are preceded by an infinite loop, so that a program without the bootstrap code
+// stops there instead of running into the routines.
+func (cw *CodeWriter) writeRoutines() {
+	if len(cw.routines) == 0 {
+		return
+	}
+
+	cw.writer.WriteString(fmt.Sprintf("(%s)\n", routineHalt))
+	cw.jump(routineHalt)
+
+	for _, cmd := range []string{parser.CMD_EQ, parser.CMD_GT, parser.CMD_LT} {
+		if cw.routines[routineCond(cmd)] {
+			cw.writeCondRoutine(cmd)
+		}
+	}
+	if cw.routines[routineCall] {
+		cw.writeCallRoutine()
+	}
+	if cw.routines[routineReturn] {
+		cw.writer.WriteString(fmt.Sprintf("(%s)\n", routineReturn))
+		cw.writeReturn()
+	}
+}
+
+// writeCondRoutine writes the routine of eq, gt or lt, which replaces x and y on the stack with x op y.
+// The return address is passed in D.
+func (cw *CodeWriter) writeCondRoutine(cmd string) {
+	label := routineCond(cmd)
+	cw.writer.WriteString(fmt.Sprintf("(%s)\n", label))
+
+	// save the return address
+	cw.writer.WriteString("@R15\n")
+	cw.writer.WriteString("M=D\n")
+
+	// D = x-y, and x is replaced with true
+	cw.writer.WriteString("@SP\n")
+	cw.writer.WriteString("AM=M-1\n")
+	cw.writer.WriteString("D=M\n")
+	cw.writer.WriteString("A=A-1\n")
+	cw.writer.WriteString("D=M-D\n")
+	cw.writer.WriteString("M=-1\n")
+
+	// keep true if the condition holds, otherwise replace it with false
+	cw.writer.WriteString(fmt.Sprintf("@%s_END\n", label))
+	switch cmd {
+	case parser.CMD_EQ:
+		cw.writer.WriteString("D;JEQ\n")
+	case parser.CMD_GT:
+		cw.writer.WriteString("D;JGT\n")
+	case parser.CMD_LT:
+		cw.writer.WriteString("D;JLT\n")
+	}
+	cw.writer.WriteString("@SP\n")
+	cw.writer.WriteString("A=M-1\n")
+	cw.writer.WriteString("M=0\n")
+
+	// return
+	cw.writer.WriteString(fmt.Sprintf("(%s_END)\n", label))
+	cw.writer.WriteString("@R15\n")
+	cw.writer.WriteString("A=M\n")
+	cw.writer.WriteString("0;JMP\n")
+}
+
+// writeCallRoutine writes the routine of call.
+// The return address is passed in D, the number of arguments in R13 and the function in R14.
+func (cw *CodeWriter) writeCallRoutine() {
+	cw.writer.WriteString(fmt.Sprintf("(%s)\n", routineCall))
+
+	// push return-addr
+	cw.writer.WriteString("@SP\n")
+	cw.writer.WriteString("A=M\n")
+	cw.writer.WriteString("M=D\n")
+
+	// push LCL, ARG, THIS and THAT
+	for _, seg := range []string{parser.SEG_LOCAL, parser.SEG_ARG, parser.SEG_THIS, parser.SEG_THAT} {
+		cw.writer.WriteString(fmt.Sprintf("@%s\n", memSegMap[seg]))
+		cw.writer.WriteString("D=M\n")
+		cw.writer.WriteString("@SP\n")
+		cw.writer.WriteString("AM=M+1\n")
+		cw.writer.WriteString("M=D\n")
+	}
+
+	// LCL = SP
+	cw.writer.WriteString("@SP\n")
+	cw.writer.WriteString("MD=M+1\n")
+	cw.writer.WriteString("@LCL\n")
+	cw.writer.WriteString("M=D\n")
+
+	// ARG = SP-n-5
+	cw.writer.WriteString("@R13\n")
+	cw.writer.WriteString("D=D-M\n")
+	cw.writer.WriteString("@5\n")
+	cw.writer.WriteString("D=D-A\n")
+	cw.writer.WriteString("@ARG\n")
+	cw.writer.WriteString("M=D\n")
+
+	// goto f
+	cw.writer.WriteString("@R14\n")
+	cw.writer.WriteString("A=M\n")
+	cw.writer.WriteString("0;JMP\n")
+}
@@ -0,0 +1,371 @@
+// Package emulator runs vm programs directly, without translating them into asm.
+// The memory is laid out as the translator does, and call and return follow the same frame protocol,
+// so the tests of projects/07 and projects/08 can check the RAM of a program run by the emulator.
+// A step is a vm command, not a CPU instruction.
+package emulator
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/uu64/nand2tetris/vm/internal/parser"
+	"github.com/uu64/nand2tetris/vm/internal/vm"
+)
+
+// RAMSize is the number of words of the RAM.
+const RAMSize = 1 << 15
+
+const (
+
+	// the registers
+	regSP   = 0
+	regLCL  = 1
+	regARG  = 2
+	regTHIS = 3
+	regTHAT = 4
+
+	pointerBase = 3
+	tempBase    = 5
+	staticBase  = 16
+	staticEnd   = 256
+	stackBase   = 256
+
+	// sysHalt is the function which stops the program.
+	sysHalt = "Sys.halt"
+)
+
+// ErrStepLimit is returned by Run when the program runs more commands than MaxSteps.
+var ErrStepLimit = errors.New("step limit exceeded")
+
+// instruction is a command with the names resolved.
+type instruction struct {
+	vm.Command
+	// target is the index of the label of goto and if-goto, or of the function of call.
+	target int
+	// static is the address of the static variable of push and pop.
+	static int
+}
+
+// Machine runs a vm program. The commands are in the order of the files,
+// and the first command runs first like the translation without the bootstrap code.
+type Machine struct {
+	RAM [RAMSize]int16
+	// MaxSteps is the limit of the number of commands which Run runs. Zero means no limit.
+	MaxSteps int
+	// Steps is the number of commands which have run.
+	Steps int
+
+	code []instruction
+	pc   int
+	// funcs maps the names of the functions to the indexes of the function commands.
+	funcs  map[string]int
+	halted bool
+}
+
+// New loads the program. The labels and the functions are resolved, and the static variables
+// are allocated from RAM[16] file by file.
+func New(prog *vm.Program) (*Machine, error) {
+	m := &Machine{funcs: map[string]int{}}
+
+	var errs parser.ErrorList
+	static := staticBase
+	for _, file := range prog.Files {
+		// scope is the function of the label, or the file outside any function
+		scope := file.Name
+		labels := map[string]int{}
+		// jumps maps the indexes of goto and if-goto to the scoped labels
+		jumps := map[int]string{}
+		first := len(m.code)
+		size := 0
+		for _, cmd := range file.All() {
+			switch cmd.Kind {
+			case vm.Function:
+				scope = cmd.Name
+				if _, ok := m.funcs[cmd.Name]; !ok {
+					m.funcs[cmd.Name] = len(m.code)
+				}
+			case vm.Label:
+				labels[scope+"$"+cmd.Name] = len(m.code)
+			case vm.Goto, vm.If:
+				jumps[len(m.code)] = scope + "$" + cmd.Name
+			case vm.Push, vm.Pop:
+				if cmd.Segment == vm.Static && cmd.Index >= size {
+					size = cmd.Index + 1
+				}
+			}
+			m.code = append(m.code, instruction{Command: cmd})
+		}
+
+		for i := first; i < len(m.code); i++ {
+			inst := &m.code[i]
+			switch inst.Kind {
+			case vm.Goto, vm.If:
+				target, ok := labels[jumps[i]]
+				if !ok {
+					errs = append(errs, inst.Errorf("undefined label %s", inst.Name))
+				}
+				inst.target = target
+			case vm.Push, vm.Pop:
+				if inst.Segment == vm.Static {
+					inst.static = static + inst.Index
+				}
+			}
+		}
+		static += size
+		if static > staticEnd {
+			return nil, fmt.Errorf("%s: too many static variables", file.Path)
+		}
+	}
+
+	for i := range m.code {
+		inst := &m.code[i]
+		if inst.Kind != vm.Call || inst.Name == sysHalt {
+			continue
+		}
+		target, ok := m.funcs[inst.Name]
+		if !ok {
+			errs = append(errs, inst.Errorf("undefined function %s", inst.Name))
+		}
+		inst.target = target
+	}
+	if err := errs.Err(); err != nil {
+		return nil, err
+	}
+	if len(m.code) >= RAMSize {
+		return nil, fmt.Errorf("too many commands: %d", len(m.code))
+	}
+	return m, nil
+}
+
+// Boot initializes SP and calls the function like the bootstrap code, which is usually Sys.init.
+// The function returns to the end of the program, where Run stops.
+func (m *Machine) Boot(function string) error {
+	m.RAM[regSP] = stackBase
+	target, ok := m.funcs[function]
+	if !ok {
+		return fmt.Errorf("undefined function %s", function)
+	}
+	m.call(target, 0, len(m.code))
+	return nil
+}
+
+// Halted reports whether the program has stopped by calling Sys.halt, by entering an infinite loop
+// of a label and a goto to it, or by returning or jumping out of the program.
+func (m *Machine) Halted() bool {
+	return m.halted || m.pc < 0 || len(m.code) <= m.pc
+}
+
+// Run runs the program until it halts. If MaxSteps is set, it stops with ErrStepLimit after MaxSteps commands.
+// A command which accesses the memory out of range stops the program with a *parser.Error at the command.
+func (m *Machine) Run() error {
+	for !m.Halted() {
+		if m.MaxSteps > 0 && m.Steps >= m.MaxSteps {
+			return ErrStepLimit
+		}
+		if err := m.Step(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Step runs one command.
+func (m *Machine) Step() error {
+	if m.Halted() {
+		return nil
+	}
+	inst := m.code[m.pc]
+	m.Steps += 1
+	m.pc += 1
+
+	switch inst.Kind {
+	case vm.Arithmetic:
+		return m.arithmetic(inst)
+	case vm.Push:
+		addr, err := m.address(inst)
+		if err != nil {
+			return err
+		}
+		if inst.Segment == vm.Constant {
+			return m.push(inst, int16(inst.Index))
+		}
+		return m.push(inst, m.RAM[addr])
+	case vm.Pop:
+		addr, err := m.address(inst)
+		if err != nil {
+			return err
+		}
+		v, err := m.pop(inst)
+		if err != nil {
+			return err
+		}
+		m.RAM[addr] = v
+	case vm.Label:
+	case vm.Goto:
+		// label L, goto L is an infinite loop which ends a program, such as Sys.init of the tests
+		if inst.target == m.pc-2 {
+			m.halted = true
+			return nil
+		}
+		m.pc = inst.target
+	case vm.If:
+		v, err := m.pop(inst)
+		if err != nil {
+			return err
+		}
+		if v != 0 {
+			m.pc = inst.target
+		}
+	case vm.Function:
+		for i := 0; i < inst.N; i++ {
+			if err := m.push(inst, 0); err != nil {
+				return err
+			}
+		}
+	case vm.Call:
+		if inst.Name == sysHalt {
+			m.halted = true
+			return nil
+		}
+		if sp := int(m.RAM[regSP]); sp < 0 || RAMSize < sp+5 {
+			return inst.Errorf("stack overflow")
+		}
+		m.call(inst.target, inst.N, m.pc)
+	case vm.Return:
+		return m.ret(inst)
+	}
+	return nil
+}
+
+// call calls the function at target with the arguments on the stack, saving the frame of the caller.
+func (m *Machine) call(target, numArgs, retAddr int) {
+	sp := int(m.RAM[regSP])
+	m.RAM[sp] = int16(retAddr)
+	m.RAM[sp+1] = m.RAM[regLCL]
+	m.RAM[sp+2] = m.RAM[regARG]
+	m.RAM[sp+3] = m.RAM[regTHIS]
+	m.RAM[sp+4] = m.RAM[regTHAT]
+	sp += 5
+	m.RAM[regSP] = int16(sp)
+	m.RAM[regARG] = int16(sp - numArgs - 5)
+	m.RAM[regLCL] = int16(sp)
+	m.pc = target
+}
+
+// ret returns the value on the stack to the caller, restoring the frame of the caller.
+func (m *Machine) ret(inst instruction) error {
+	frame := int(m.RAM[regLCL])
+	arg := int(m.RAM[regARG])
+	if frame < 5 || !inRAM(arg) {
+		return inst.Errorf("invalid frame: LCL=%d ARG=%d", frame, arg)
+	}
+	retAddr := m.RAM[frame-5]
+	v, err := m.pop(inst)
+	if err != nil {
+		return err
+	}
+	m.RAM[arg] = v
+	m.RAM[regSP] = int16(arg + 1)
+	m.RAM[regTHAT] = m.RAM[frame-1]
+	m.RAM[regTHIS] = m.RAM[frame-2]
+	m.RAM[regARG] = m.RAM[frame-3]
+	m.RAM[regLCL] = m.RAM[frame-4]
+	m.pc = int(retAddr)
+	return nil
+}
+
+func inRAM(addr int) bool {
+	return 0 <= addr && addr < RAMSize
+}
+
+// address returns the address of the operand of push and pop. It is not used for the constant segment.
+func (m *Machine) address(inst instruction) (int, error) {
+	var addr int
+	switch inst.Segment {
+	case vm.Constant:
+		return 0, nil
+	case vm.Local:
+		addr = int(m.RAM[regLCL]) + inst.Index
+	case vm.Argument:
+		addr = int(m.RAM[regARG]) + inst.Index
+	case vm.This:
+		addr = int(m.RAM[regTHIS]) + inst.Index
+	case vm.That:
+		addr = int(m.RAM[regTHAT]) + inst.Index
+	case vm.Pointer:
+		addr = pointerBase + inst.Index
+	case vm.Temp:
+		addr = tempBase + inst.Index
+	case vm.Static:
+		addr = inst.static
+	}
+	if !inRAM(addr) {
+		return 0, inst.Errorf("address %d out of range", addr)
+	}
+	return addr, nil
+}
+
+func (m *Machine) push(inst instruction, v int16) error {
+	sp := int(m.RAM[regSP])
+	if !inRAM(sp) {
+		return inst.Errorf("stack overflow")
+	}
+	m.RAM[sp] = v
+	m.RAM[regSP] = int16(sp + 1)
+	return nil
+}
+
+func (m *Machine) pop(inst instruction) (int16, error) {
+	sp := int(m.RAM[regSP]) - 1
+	if !inRAM(sp) {
+		return 0, inst.Errorf("stack underflow")
+	}
+	m.RAM[regSP] = int16(sp)
+	return m.RAM[sp], nil
+}
+
+func (m *Machine) arithmetic(inst instruction) error {
+	y, err := m.pop(inst)
+	if err != nil {
+		return err
+	}
+	if inst.Op.Unary() {
+		switch inst.Op {
+		case vm.Neg:
+			return m.push(inst, -y)
+		case vm.Not:
+			return m.push(inst, ^y)
+		}
+	}
+	x, err := m.pop(inst)
+	if err != nil {
+		return err
+	}
+
+	var v int16
+	switch inst.Op {
+	case vm.Add:
+		v = x + y
+	case vm.Sub:
+		v = x - y
+	case vm.And:
+		v = x & y
+	case vm.Or:
+		v = x | y
+	case vm.Eq:
+		v = boolean(x == y)
+	case vm.Gt:
+		v = boolean(x > y)
+	case vm.Lt:
+		v = boolean(x < y)
+	}
+	return m.push(inst, v)
+}
+
+// boolean returns true as -1 and false as 0.
+func boolean(b bool) int16 {
+	if b {
+		return -1
+	}
+	return 0
+}
@@ -0,0 +1,137 @@
+package emulator
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/uu64/nand2tetris/vm/internal/parser"
+	"github.com/uu64/nand2tetris/vm/internal/vm"
+)
+
+// load parses the sources and the OS of tools/OS if os is true.
+func load(t *testing.T, os bool, srcs map[string]string) *Machine {
+	t.Helper()
+	prog := &vm.Program{}
+	if os {
+		paths, err := filepath.Glob("../../../tools/OS/*.vm")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if prog, err = vm.ParseFiles(paths); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, src := range srcs {
+		file, err := vm.Parse(name, strings.NewReader(src))
+		if err != nil {
+			t.Fatalf("Parse() = %v", err)
+		}
+		prog.Files = append(prog.Files, file)
+	}
+	m, err := New(prog)
+	if err != nil {
+		t.Fatalf("New() = %v", err)
+	}
+	return m
+}
+
+// TestOS runs a program with the OS, which halts after Main.main returns.
+func TestOS(t *testing.T) {
+	m := load(t, true, map[string]string{"Main.vm": `function Main.main 1
+push constant 6
+push constant 7
+call Math.multiply 2
+pop local 0
+push local 0
+push constant 1000
+call Math.divide 2
+push local 0
+add
+return
+`})
+	if err := m.Boot(vm.SysInit); err != nil {
+		t.Fatal(err)
+	}
+	// Output.init takes most of the steps to build the font
+	m.MaxSteps = 10000000
+	if err := m.Run(); err != nil {
+		t.Fatalf("Run() = %v after %d steps", err, m.Steps)
+	}
+	if !m.Halted() {
+		t.Errorf("Halted() = false")
+	}
+	// Sys.init pops the return value of Main.main to temp 0
+	if got := m.RAM[tempBase]; got != 42 {
+		t.Errorf("Main.main() = %d, want 42", got)
+	}
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		// stack is the values on the stack when the program halts
+		stack []int16
+	}{
+		{name: "arithmetic", src: "push constant 7\npush constant 9\nsub\nneg\npush constant 5\nnot\nand\n", stack: []int16{2}},
+		{name: "compare", src: "push constant 1\npush constant 2\nlt\npush constant 1\npush constant 2\ngt\npush constant 3\npush constant 3\neq\n", stack: []int16{-1, 0, -1}},
+		{name: "overflow", src: "push constant 32767\npush constant 1\nadd\n", stack: []int16{-32768}},
+		{name: "segments", src: "push constant 3000\npop pointer 0\npush constant 4000\npop pointer 1\npush constant 10\npop this 2\npush constant 20\npop that 3\npush constant 30\npop temp 7\npush constant 40\npop static 1\npush this 2\npush that 3\npush temp 7\npush static 1\npush pointer 1\n", stack: []int16{10, 20, 30, 40, 4000}},
+		{name: "loop", src: "push constant 0\npop temp 0\nlabel LOOP\npush temp 0\npush constant 1\nadd\npop temp 0\npush temp 0\npush constant 5\nlt\nif-goto LOOP\npush temp 0\n", stack: []int16{5}},
+		{name: "call", src: "push constant 3\npush constant 4\ncall Main.add 2\ncall Sys.halt 0\nfunction Main.add 1\npush argument 0\npush argument 1\nadd\npop local 0\npush local 0\nreturn\n", stack: []int16{7}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := load(t, false, map[string]string{"Main.vm": tt.src})
+			m.RAM[regSP] = stackBase
+			if err := m.Run(); err != nil {
+				t.Fatalf("Run() = %v", err)
+			}
+			got := m.RAM[stackBase:m.RAM[regSP]]
+			if len(got) != len(tt.stack) {
+				t.Fatalf("stack = %v, want %v", got, tt.stack)
+			}
+			for i := range got {
+				if got[i] != tt.stack[i] {
+					t.Errorf("stack = %v, want %v", got, tt.stack)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestStepLimit(t *testing.T) {
+	m := load(t, false, map[string]string{"Main.vm": "label A\npush constant 0\ngoto A\n"})
+	m.RAM[regSP] = stackBase
+	m.MaxSteps = 30
+	if err := m.Run(); !errors.Is(err, ErrStepLimit) {
+		t.Errorf("Run() = %v, want ErrStepLimit", err)
+	}
+	if m.Steps != 30 {
+		t.Errorf("Steps = %d, want 30", m.Steps)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	prog := &vm.Program{}
+	file, err := vm.Parse("Main.vm", strings.NewReader("call Main.f 0\ngoto NOWHERE\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	prog.Files = append(prog.Files, file)
+	_, err = New(prog)
+	var errs parser.ErrorList
+	if !errors.As(err, &errs) || len(errs) != 2 {
+		t.Errorf("New() = %v, want 2 errors", err)
+	}
+
+	m := load(t, false, map[string]string{"Main.vm": "push constant 1\npop temp 0\nneg\n"})
+	var perr *parser.Error
+	if err := m.Run(); !errors.As(err, &perr) || perr.Line != 3 || perr.Message != "stack underflow" {
+		t.Errorf("Run() = %v, want stack underflow at line 3", err)
+	}
+}
@@ -0,0 +1,40 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Error describes a problem found at a command of a vm file.
+type Error struct {
+	File    string
+	Line    int
+	Text    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Text == "" {
+		return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Message)
+	}
+	return fmt.Sprintf("%s:%d: %s: %q", e.File, e.Line, e.Message, e.Text)
+}
+
+// ErrorList is a collection of errors reported as a single error.
+type ErrorList []*Error
+
+func (l ErrorList) Error() string {
+	msgs := make([]string, len(l))
+	for i, e := range l {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Err returns the list as an error, or nil if it is empty.
+func (l ErrorList) Err() error {
+	if len(l) == 0 {
+		return nil
+	}
+	return l
+}
@@ -2,48 +2,78 @@ package parser
 
 import (
 	"bufio"
-	"bytes"
 	"fmt"
 	"io"
-	"log"
-	"regexp"
 	"strconv"
+	"strings"
 )
 
+// maxConst is the largest constant that can be pushed.
+const maxConst = 1<<15 - 1
+
+// segmentSize is the number of entries of the fixed-size segments.
+var segmentSize = map[string]int{
+	SEG_PTR:  2,
+	SEG_TEMP: 8,
+}
+
 type Parser struct {
 	scanner         *bufio.Scanner
 	hasMoreCommands bool
+	file            string
+	line            int
+	text            string
 	currentCmd      CmdType
 	arg1            string
 	arg2            int
 }
 
-func New(f io.Reader) *Parser {
+// New returns a Parser which reads the vm file. file is the name used in errors.
+func New(file string, f io.Reader) *Parser {
 	s := bufio.NewScanner(f)
-	return &Parser{scanner: s, hasMoreCommands: true}
+	return &Parser{scanner: s, hasMoreCommands: true, file: file}
 }
 
 func (p *Parser) HasMoreCommands() bool {
 	return p.hasMoreCommands
 }
 
+// Advance reads the next line and parses it.
+// An invalid command is returned as an *Error, and the command type is set to EMPTY
+// so that the caller may continue with the next line.
 func (p *Parser) Advance() error {
 	if !p.scanner.Scan() {
-		err := p.scanner.Err()
-		// io.EOF
-		if err == nil {
-			p.hasMoreCommands = false
-		} else {
-			log.Fatal("Parser.Advance: %w", err)
+		p.hasMoreCommands = false
+		p.currentCmd = EMPTY
+		// Err returns nil on io.EOF
+		if err := p.scanner.Err(); err != nil {
+			return fmt.Errorf("Parser.Advance: %w", err)
 		}
+		return nil
 	}
-	return p.parse(p.scanner.Bytes())
+	p.line += 1
+	return p.parse(p.scanner.Text())
 }
 
 func (p *Parser) CommandType() CmdType {
 	return p.currentCmd
 }
 
+// File returns the name of the vm file.
+func (p *Parser) File() string {
+	return p.file
+}
+
+// Line returns the 1-based line number of the current command.
+func (p *Parser) Line() int {
+	return p.line
+}
+
+// Text returns the current command without the comment.
+func (p *Parser) Text() string {
+	return p.text
+}
+
 func (p *Parser) Arg1() string {
 	return p.arg1
 }
@@ -52,71 +82,149 @@ func (p *Parser) Arg2() int {
 	return p.arg2
 }
 
-var regexpCmd = regexp.MustCompile(`^(?P<cmd>[a-z\-]+)\s*(?P<arg1>[A-Za-z_:\.][0-9A-Za-z_:\.]+)*\s*(?P<arg2>[0-9]+)*`)
+// Errorf returns an *Error at the current command.
+func (p *Parser) Errorf(format string, a ...interface{}) *Error {
+	return &Error{File: p.file, Line: p.line, Text: p.text, Message: fmt.Sprintf(format, a...)}
+}
 
-func (p *Parser) parse(row []byte) error {
+func (p *Parser) parse(row string) error {
 	p.arg1 = ""
 	p.arg2 = 0
 
-	b := bytes.TrimSpace(row)
-
-	// skip empty row
-	if len(b) == 0 {
-		p.currentCmd = EMPTY
-		return nil
+	// strip comment
+	comment := false
+	if i := strings.Index(row, "//"); i >= 0 {
+		row = row[:i]
+		comment = true
 	}
+	p.text = strings.TrimSpace(row)
 
-	// skip comment
-	if bytes.HasPrefix(b, []byte("//")) {
-		p.currentCmd = COMMENT
+	fields := strings.Fields(row)
+	if len(fields) == 0 {
+		if comment {
+			p.currentCmd = COMMENT
+		} else {
+			p.currentCmd = EMPTY
+		}
 		return nil
 	}
 
-	// parse
-	matches := regexpCmd.FindSubmatch(b)
-	if len(matches) == 0 {
-		return fmt.Errorf("invalid format: %s", string(b))
-	}
-
-	cmd := matches[regexpCmd.SubexpIndex("cmd")]
-	arg1 := matches[regexpCmd.SubexpIndex("arg1")]
-	arg2 := matches[regexpCmd.SubexpIndex("arg2")]
+	// a command is EMPTY until it is parsed without errors
+	p.currentCmd = EMPTY
 
-	switch string(cmd) {
+	cmd, args := fields[0], fields[1:]
+	var cmdType CmdType
+	switch cmd {
 	case CMD_ADD, CMD_SUB, CMD_NEG, CMD_EQ, CMD_GT, CMD_LT, CMD_AND, CMD_OR, CMD_NOT:
-		p.currentCmd = C_ARITHMETRIC
-		p.arg1 = string(cmd)
+		cmdType = C_ARITHMETRIC
 	case CMD_RETURN:
-		p.currentCmd = C_RETURN
+		cmdType = C_RETURN
 	case CMD_LABEL:
-		p.currentCmd = C_LABEL
-		p.arg1 = string(arg1)
+		cmdType = C_LABEL
 	case CMD_GOTO:
-		p.currentCmd = C_GOTO
-		p.arg1 = string(arg1)
+		cmdType = C_GOTO
 	case CMD_IF:
-		p.currentCmd = C_IF
-		p.arg1 = string(arg1)
-	// ignore the error because arg2 is ensured that be a numeric by regexp
+		cmdType = C_IF
 	case CMD_FUNC:
-		p.currentCmd = C_FUNCTION
-		p.arg1 = string(arg1)
-		p.arg2, _ = strconv.Atoi(string(arg2))
+		cmdType = C_FUNCTION
 	case CMD_CALL:
-		p.currentCmd = C_CALL
-		p.arg1 = string(arg1)
-		p.arg2, _ = strconv.Atoi(string(arg2))
+		cmdType = C_CALL
 	case CMD_PUSH:
-		p.currentCmd = C_PUSH
-		p.arg1 = string(arg1)
-		p.arg2, _ = strconv.Atoi(string(arg2))
+		cmdType = C_PUSH
 	case CMD_POP:
-		p.currentCmd = C_POP
-		p.arg1 = string(arg1)
-		p.arg2, _ = strconv.Atoi(string(arg2))
+		cmdType = C_POP
 	default:
-		return fmt.Errorf("unknown command: %s %s %s", string(cmd), string(arg1), string(arg2))
+		return p.Errorf("unknown command %s", cmd)
+	}
+
+	if want := arity(cmdType); len(args) != want {
+		return p.Errorf("%s takes %d arguments, got %d", cmd, want, len(args))
 	}
 
+	switch cmdType {
+	case C_ARITHMETRIC:
+		p.arg1 = cmd
+	case C_LABEL, C_GOTO, C_IF:
+		if !isSymbol(args[0]) {
+			return p.Errorf("invalid label %s", args[0])
+		}
+		p.arg1 = args[0]
+	case C_FUNCTION, C_CALL:
+		if !isSymbol(args[0]) {
+			return p.Errorf("invalid function name %s", args[0])
+		}
+		n, err := p.number(args[1])
+		if err != nil {
+			return err
+		}
+		p.arg1, p.arg2 = args[0], n
+	case C_PUSH, C_POP:
+		segment := args[0]
+		index, err := p.number(args[1])
+		if err != nil {
+			return err
+		}
+		if err := p.checkSegment(cmdType, segment, index); err != nil {
+			return err
+		}
+		p.arg1, p.arg2 = segment, index
+	}
+
+	p.currentCmd = cmdType
 	return nil
 }
+
+// arity returns the number of arguments of the command type.
+func arity(cmdType CmdType) int {
+	switch cmdType {
+	case C_LABEL, C_GOTO, C_IF:
+		return 1
+	case C_FUNCTION, C_CALL, C_PUSH, C_POP:
+		return 2
+	}
+	return 0
+}
+
+// number parses a non-negative decimal number.
+func (p *Parser) number(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 || strings.HasPrefix(s, "+") {
+		return 0, p.Errorf("invalid number %s", s)
+	}
+	return n, nil
+}
+
+func (p *Parser) checkSegment(cmdType CmdType, segment string, index int) error {
+	switch segment {
+	case SEG_CONST:
+		if cmdType == C_POP {
+			return p.Errorf("pop constant is illegal")
+		}
+		if index > maxConst {
+			return p.Errorf("constant %d out of range 0..%d", index, maxConst)
+		}
+	case SEG_PTR, SEG_TEMP:
+		if size := segmentSize[segment]; index >= size {
+			return p.Errorf("%s index %d out of range 0..%d", segment, index, size-1)
+		}
+	case SEG_ARG, SEG_LOCAL, SEG_STATIC, SEG_THIS, SEG_THAT:
+	default:
+		return p.Errorf("unknown segment %s", segment)
+	}
+	return nil
+}
+
+// isSymbol reports whether s is a label or a function name,
+// which consists of letters, digits, _, ., : and $, and does not start with a digit.
+func isSymbol(s string) bool {
+	for i, c := range s {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z':
+		case c == '_', c == '.', c == ':', c == '$':
+		case '0' <= c && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return len(s) > 0
+}
@@ -0,0 +1,134 @@
+package parser
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		row     string
+		cmdType CmdType
+		arg1    string
+		arg2    int
+	}{
+		{row: "add", cmdType: C_ARITHMETRIC, arg1: "add"},
+		{row: "  not  // complement", cmdType: C_ARITHMETRIC, arg1: "not"},
+		{row: "return", cmdType: C_RETURN},
+		{row: "label LOOP_START", cmdType: C_LABEL, arg1: "LOOP_START"},
+		{row: "goto Main.end$1", cmdType: C_GOTO, arg1: "Main.end$1"},
+		{row: "if-goto a:b", cmdType: C_IF, arg1: "a:b"},
+		{row: "function Main.fib 2", cmdType: C_FUNCTION, arg1: "Main.fib", arg2: 2},
+		{row: "call Math.multiply 2", cmdType: C_CALL, arg1: "Math.multiply", arg2: 2},
+		{row: "push constant 32767", cmdType: C_PUSH, arg1: "constant", arg2: 32767},
+		{row: "push temp 7", cmdType: C_PUSH, arg1: "temp", arg2: 7},
+		{row: "pop pointer 1", cmdType: C_POP, arg1: "pointer", arg2: 1},
+		{row: "\tpop static 300\t", cmdType: C_POP, arg1: "static", arg2: 300},
+		{row: "// comment", cmdType: COMMENT},
+		{row: "   ", cmdType: EMPTY},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.row, func(t *testing.T) {
+			p := New("A.vm", strings.NewReader(tt.row))
+			if err := p.Advance(); err != nil {
+				t.Fatalf("Advance() = %v", err)
+			}
+			if p.CommandType() != tt.cmdType || p.Arg1() != tt.arg1 || p.Arg2() != tt.arg2 {
+				t.Errorf("command = %v %q %d, want %v %q %d", p.CommandType(), p.Arg1(), p.Arg2(), tt.cmdType, tt.arg1, tt.arg2)
+			}
+		})
+	}
+}
+
+func TestParseError(t *testing.T) {
+	tests := []struct {
+		row  string
+		want string
+	}{
+		// missing and extra arguments of each kind of command
+		{row: "add 1", want: `add takes 0 arguments, got 1: "add 1"`},
+		{row: "return 0", want: `return takes 0 arguments, got 1: "return 0"`},
+		{row: "label", want: `label takes 1 arguments, got 0: "label"`},
+		{row: "goto A B", want: `goto takes 1 arguments, got 2: "goto A B"`},
+		{row: "if-goto", want: `if-goto takes 1 arguments, got 0: "if-goto"`},
+		{row: "function Main.main", want: `function takes 2 arguments, got 1: "function Main.main"`},
+		{row: "call Main.main 0 1", want: `call takes 2 arguments, got 3: "call Main.main 0 1"`},
+		{row: "push constant", want: `push takes 2 arguments, got 1: "push constant"`},
+		{row: "pop local 0 0 // x", want: `pop takes 2 arguments, got 3: "pop local 0 0"`},
+
+		// segments and indexes
+		{row: "pop constant 0", want: `pop constant is illegal: "pop constant 0"`},
+		{row: "push temp 8", want: `temp index 8 out of range 0..7: "push temp 8"`},
+		{row: "push pointer 2", want: `pointer index 2 out of range 0..1: "push pointer 2"`},
+		{row: "push constant 32768", want: `constant 32768 out of range 0..32767: "push constant 32768"`},
+		{row: "push heap 0", want: `unknown segment heap: "push heap 0"`},
+		{row: "push local x", want: `invalid number x: "push local x"`},
+		{row: "push local -1", want: `invalid number -1: "push local -1"`},
+		{row: "push local +1", want: `invalid number +1: "push local +1"`},
+		{row: "function Main.main n", want: `invalid number n: "function Main.main n"`},
+
+		// names
+		{row: "mul", want: `unknown command mul: "mul"`},
+		{row: "label 1LOOP", want: `invalid label 1LOOP: "label 1LOOP"`},
+		{row: "call Main-main 0", want: `invalid function name Main-main: "call Main-main 0"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.row, func(t *testing.T) {
+			p := New("A.vm", strings.NewReader(tt.row))
+			err := p.Advance()
+			var e *Error
+			if !errors.As(err, &e) {
+				t.Fatalf("Advance() = %v, want an *Error", err)
+			}
+			if want := "A.vm:1: " + tt.want; e.Error() != want {
+				t.Errorf("Advance() = %s, want %s", e.Error(), want)
+			}
+			if p.CommandType() != EMPTY {
+				t.Errorf("CommandType() = %v, want EMPTY", p.CommandType())
+			}
+		})
+	}
+}
+
+// TestErrorList parses a file with several errors, which are collected with their lines
+// while the valid commands are still parsed.
+func TestErrorList(t *testing.T) {
+	src := "push constant 1\npop constant 0\n\n// comment\npush that\nadd\npush temp 9 // t\n"
+	p := New("Main.vm", strings.NewReader(src))
+	var errs ErrorList
+	var cmds []string
+	for p.HasMoreCommands() {
+		if err := p.Advance(); err != nil {
+			var e *Error
+			if !errors.As(err, &e) {
+				t.Fatal(err)
+			}
+			errs = append(errs, e)
+			continue
+		}
+		if p.CommandType() != EMPTY && p.CommandType() != COMMENT {
+			cmds = append(cmds, p.Text())
+		}
+	}
+
+	want := `Main.vm:2: pop constant is illegal: "pop constant 0"
+Main.vm:5: push takes 2 arguments, got 1: "push that"
+Main.vm:7: temp index 9 out of range 0..7: "push temp 9"`
+	if err := errs.Err(); err == nil || err.Error() != want {
+		t.Errorf("errors =\n%v\nwant\n%s", err, want)
+	}
+	for _, e := range errs {
+		if e.File != "Main.vm" {
+			t.Errorf("File = %q, want Main.vm", e.File)
+		}
+	}
+	if got := strings.Join(cmds, ", "); got != "push constant 1, add" {
+		t.Errorf("commands = %s, want push constant 1, add", got)
+	}
+	if (ErrorList{}).Err() != nil {
+		t.Errorf("Err() of an empty list is not nil")
+	}
+}
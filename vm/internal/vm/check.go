@@ -0,0 +1,173 @@
+package vm
+
+import (
+	"sort"
+
+	"github.com/uu64/nand2tetris/vm/internal/parser"
+)
+
+const (
+	// SysInit is the function which the bootstrap code calls.
+	SysInit = "Sys.init"
+	// mainMain is the function which Sys.init of the OS calls.
+	mainMain = "Main.main"
+)
+
+// site is the first call of a function, which the other calls are compared with.
+type site struct {
+	numArgs int
+	pos     Pos
+}
+
+// Check analyzes the call graph of the program. It reports
+//
+//   - duplicate functions
+//   - calls to the functions which are neither defined nor in externals
+//   - calls with a number of arguments which differs from the other calls or from externals
+//   - local and argument indexes beyond the locals of the function and the arguments of the calls
+//   - functions which are never reached from Sys.init
+//   - functions which can reach the end of the body without return
+//
+// externals are the functions which may be called without being defined, with their number of arguments,
+// such as OS. If Sys.init is not defined, the program is reached from Main.main, which Sys.init of the OS calls.
+func (p *Program) Check(externals map[string]int) parser.ErrorList {
+	var errs parser.ErrorList
+
+	// funcs maps the names to the functions, which are listed in the order of the definitions
+	funcs := map[string]*Func{}
+	var list []*Func
+	for _, file := range p.Files {
+		for _, f := range file.Funcs {
+			if first, ok := funcs[f.Name]; ok {
+				errs = append(errs, f.Command().Errorf("duplicate function %s, first defined at %s", f.Name, first.Pos))
+				continue
+			}
+			funcs[f.Name] = f
+			list = append(list, f)
+		}
+	}
+
+	// calls
+	sites := map[string]site{}
+	for _, file := range p.Files {
+		for _, cmd := range file.All() {
+			if cmd.Kind != Call {
+				continue
+			}
+			_, defined := funcs[cmd.Name]
+			numArgs, external := externals[cmd.Name]
+			switch {
+			case !defined && !external:
+				errs = append(errs, cmd.Errorf("undefined function %s", cmd.Name))
+			case !defined && numArgs != cmd.N:
+				errs = append(errs, cmd.Errorf("%s takes %d arguments, called with %d", cmd.Name, numArgs, cmd.N))
+			case defined:
+				first, ok := sites[cmd.Name]
+				if !ok {
+					sites[cmd.Name] = site{numArgs: cmd.N, pos: cmd.Pos}
+					continue
+				}
+				if first.numArgs != cmd.N {
+					errs = append(errs, cmd.Errorf("%s is called with %d arguments, but with %d at %s", cmd.Name, cmd.N, first.numArgs, first.pos))
+				}
+			}
+		}
+	}
+
+	// locals and arguments
+	for _, f := range list {
+		first, called := sites[f.Name]
+		for _, cmd := range f.Body {
+			if cmd.Kind != Push && cmd.Kind != Pop {
+				continue
+			}
+			switch {
+			case cmd.Segment == Local && cmd.Index >= f.NumLocals:
+				errs = append(errs, cmd.Errorf("local %d out of range: %s has %d locals", cmd.Index, f.Name, f.NumLocals))
+			case cmd.Segment == Argument && called && cmd.Index >= first.numArgs:
+				errs = append(errs, cmd.Errorf("argument %d out of range: %s is called with %d arguments at %s", cmd.Index, f.Name, first.numArgs, first.pos))
+			}
+		}
+	}
+
+	// reachability from the entry
+	entry := SysInit
+	if _, ok := funcs[SysInit]; !ok {
+		entry = mainMain
+	}
+	if _, ok := funcs[entry]; ok {
+		reached := p.Reachable(entry)
+		for _, f := range list {
+			// the OS is a library, whose functions are not all used
+			if !reached[f.Name] && !isOSClass(f.Name) {
+				errs = append(errs, f.Command().Errorf("%s is never called from %s", f.Name, entry))
+			}
+		}
+	}
+
+	// return
+	for _, f := range list {
+		if fallsOff(f.Body) {
+			errs = append(errs, f.Command().Errorf("%s can reach the end without return", f.Name))
+		}
+	}
+
+	p.sort(errs)
+	return errs
+}
+
+// fallsOff reports whether the commands can run past the last command.
+func fallsOff(body []Command) bool {
+	labels := map[string]int{}
+	for i, cmd := range body {
+		if cmd.Kind == Label {
+			labels[cmd.Name] = i
+		}
+	}
+
+	visited := make([]bool, len(body)+1)
+	stack := []int{0}
+	for len(stack) > 0 {
+		i := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if visited[i] {
+			continue
+		}
+		visited[i] = true
+		if i == len(body) {
+			return true
+		}
+
+		cmd := body[i]
+		switch cmd.Kind {
+		case Return:
+		case Goto:
+			// an undefined label is reported by CheckLabels
+			if target, ok := labels[cmd.Name]; ok {
+				stack = append(stack, target)
+			}
+		case If:
+			if target, ok := labels[cmd.Name]; ok {
+				stack = append(stack, target)
+			}
+			stack = append(stack, i+1)
+		default:
+			stack = append(stack, i+1)
+		}
+	}
+	return false
+}
+
+// sort sorts the errors in the order of the files and the lines.
+func (p *Program) sort(errs parser.ErrorList) {
+	order := map[string]int{}
+	for i, file := range p.Files {
+		order[file.Path] = i
+	}
+	sort.SliceStable(errs, func(i, j int) bool {
+		if errs[i].File != errs[j].File {
+			return order[errs[i].File] < order[errs[j].File]
+		}
+		return errs[i].Line < errs[j].Line
+	})
+}
@@ -0,0 +1,90 @@
+package vm
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	src := `function Main.main 1
+push local 1
+call Main.f 1
+call Main.f 2
+call Math.multiply 1
+call Foo.bar 0
+return
+function Main.f 0
+push argument 1
+push constant 0
+if-goto END
+return
+label END
+function Main.unused 0
+return
+function Main.f 0
+return
+function Main.loop 0
+label LOOP
+goto LOOP
+`
+	file, err := Parse("Main.vm", strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("Parse() = %v", err)
+	}
+	prog := &Program{Files: []*File{file}}
+
+	var got []string
+	for _, err := range prog.Check(OS) {
+		got = append(got, err.Error())
+	}
+	want := []string{
+		`Main.vm:2: local 1 out of range: Main.main has 1 locals: "push local 1"`,
+		`Main.vm:4: Main.f is called with 2 arguments, but with 1 at Main.vm:3: "call Main.f 2"`,
+		`Main.vm:5: Math.multiply takes 2 arguments, called with 1: "call Math.multiply 1"`,
+		`Main.vm:6: undefined function Foo.bar: "call Foo.bar 0"`,
+		`Main.vm:8: Main.f can reach the end without return: "function Main.f 0"`,
+		`Main.vm:9: argument 1 out of range: Main.f is called with 1 arguments at Main.vm:3: "push argument 1"`,
+		`Main.vm:14: Main.unused is never called from Main.main: "function Main.unused 0"`,
+		`Main.vm:16: duplicate function Main.f, first defined at Main.vm:8: "function Main.f 0"`,
+		`Main.vm:18: Main.loop is never called from Main.main: "function Main.loop 0"`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Check() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+// TestOS checks OS against the OS in tools/OS, which has no problems with itself as externals.
+func TestOS(t *testing.T) {
+	paths, err := filepath.Glob("../../../tools/OS/*.vm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prog, err := ParseFiles(paths)
+	if err != nil {
+		t.Fatalf("ParseFiles() = %v", err)
+	}
+	for name := range OS {
+		if _, _, ok := prog.Func(name); !ok {
+			t.Errorf("%s is not defined in tools/OS", name)
+		}
+	}
+
+	for _, file := range prog.Files {
+		for _, cmd := range file.All() {
+			if n, ok := OS[cmd.Name]; ok && cmd.Kind == Call && cmd.N != n {
+				t.Errorf("%s: OS[%s] = %d, want %d", cmd.Pos, cmd.Name, n, cmd.N)
+			}
+		}
+	}
+
+	// Sys.init calls Main.main of the program
+	externals := map[string]int{mainMain: 0}
+	for name, n := range OS {
+		externals[name] = n
+	}
+	for _, err := range prog.Check(externals) {
+		t.Error(err)
+	}
+}
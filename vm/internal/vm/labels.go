@@ -0,0 +1,76 @@
+package vm
+
+import (
+	"fmt"
+
+	"github.com/uu64/nand2tetris/vm/internal/parser"
+)
+
+// Errorf returns a *parser.Error at the command.
+func (c Command) Errorf(format string, a ...interface{}) *parser.Error {
+	return &parser.Error{File: c.Pos.File, Line: c.Pos.Line, Text: c.String(), Message: fmt.Sprintf(format, a...)}
+}
+
+// scope is the commands where the labels are visible,
+// which are the body of a function or the commands of a file before the first function.
+type scope struct {
+	name     string
+	commands []Command
+}
+
+func (p *Program) scopes() []scope {
+	var scopes []scope
+	for _, file := range p.Files {
+		if len(file.Commands) > 0 {
+			scopes = append(scopes, scope{name: file.Name, commands: file.Commands})
+		}
+		for _, f := range file.Funcs {
+			scopes = append(scopes, scope{name: f.Name, commands: f.Body})
+		}
+	}
+	return scopes
+}
+
+// CheckLabels reports the duplicate labels, and goto and if-goto to the labels which are not defined in the function.
+// The labels are scoped by the function, so a jump to a label of another function is reported as such.
+func (p *Program) CheckLabels() parser.ErrorList {
+	var errs parser.ErrorList
+
+	scopes := p.scopes()
+	defined := make([]map[string]Command, len(scopes))
+	// owners maps a label to the first scope which defines it
+	owners := map[string]string{}
+	for i, s := range scopes {
+		defined[i] = map[string]Command{}
+		for _, cmd := range s.commands {
+			if cmd.Kind != Label {
+				continue
+			}
+			if first, ok := defined[i][cmd.Name]; ok {
+				errs = append(errs, cmd.Errorf("duplicate label %s, first defined at line %d", cmd.Name, first.Pos.Line))
+				continue
+			}
+			defined[i][cmd.Name] = cmd
+			if _, ok := owners[cmd.Name]; !ok {
+				owners[cmd.Name] = s.name
+			}
+		}
+	}
+
+	for i, s := range scopes {
+		for _, cmd := range s.commands {
+			if cmd.Kind != Goto && cmd.Kind != If {
+				continue
+			}
+			if _, ok := defined[i][cmd.Name]; ok {
+				continue
+			}
+			if owner, ok := owners[cmd.Name]; ok {
+				errs = append(errs, cmd.Errorf("label %s is defined in %s, not in %s: jumps across functions are not allowed", cmd.Name, owner, s.name))
+				continue
+			}
+			errs = append(errs, cmd.Errorf("undefined label %s", cmd.Name))
+		}
+	}
+	return errs
+}
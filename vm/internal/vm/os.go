@@ -0,0 +1,85 @@
+package vm
+
+import "strings"
+
+// OS is the number of arguments of the functions of the Jack OS in tools/OS,
+// which a program may call without including the OS in the inputs.
+// A method and a destructor take the object as the first argument.
+var OS = map[string]int{
+	"Array.new":     1,
+	"Array.dispose": 1,
+
+	"Keyboard.init":       0,
+	"Keyboard.keyPressed": 0,
+	"Keyboard.readChar":   0,
+	"Keyboard.readLine":   1,
+	"Keyboard.readInt":    1,
+
+	"Math.init":     0,
+	"Math.abs":      1,
+	"Math.multiply": 2,
+	"Math.divide":   2,
+	"Math.min":      2,
+	"Math.max":      2,
+	"Math.sqrt":     1,
+
+	"Memory.init":    0,
+	"Memory.peek":    1,
+	"Memory.poke":    2,
+	"Memory.alloc":   1,
+	"Memory.deAlloc": 1,
+
+	"Output.init":        0,
+	"Output.moveCursor":  2,
+	"Output.printChar":   1,
+	"Output.printString": 1,
+	"Output.printInt":    1,
+	"Output.println":     0,
+	"Output.backSpace":   0,
+
+	"Screen.init":          0,
+	"Screen.clearScreen":   0,
+	"Screen.setColor":      1,
+	"Screen.drawPixel":     2,
+	"Screen.drawLine":      4,
+	"Screen.drawRectangle": 4,
+	"Screen.drawCircle":    3,
+
+	"String.new":           1,
+	"String.dispose":       1,
+	"String.length":        1,
+	"String.charAt":        2,
+	"String.setCharAt":     3,
+	"String.appendChar":    2,
+	"String.eraseLastChar": 1,
+	"String.intValue":      1,
+	"String.setInt":        2,
+	"String.backSpace":     0,
+	"String.doubleQuote":   0,
+	"String.newLine":       0,
+
+	"Sys.init":  0,
+	"Sys.halt":  0,
+	"Sys.error": 1,
+	"Sys.wait":  1,
+}
+
+// className returns the class of a function, such as Main of Main.main.
+func className(function string) string {
+	if i := strings.Index(function, "."); i >= 0 {
+		return function[:i]
+	}
+	return function
+}
+
+// isOSClass reports whether the function belongs to a class of the OS,
+// including the private functions which are not in OS.
+func isOSClass(function string) bool {
+	class := className(function)
+	for name := range OS {
+		if className(name) == class {
+			return true
+		}
+	}
+	return false
+}
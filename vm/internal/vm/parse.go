@@ -0,0 +1,124 @@
+package vm
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/uu64/nand2tetris/vm/internal/parser"
+)
+
+// Parse reads a vm file. path is the name used in positions and errors.
+// If the file has errors, all of them are returned as a parser.ErrorList.
+func Parse(path string, r io.Reader) (*File, error) {
+	file := &File{
+		Path: path,
+		Name: strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)),
+	}
+
+	var errs parser.ErrorList
+	var fn *Func
+	p := parser.New(path, r)
+	for p.HasMoreCommands() {
+		if err := p.Advance(); err != nil {
+			var perr *parser.Error
+			if !errors.As(err, &perr) {
+				return nil, err
+			}
+			errs = append(errs, perr)
+			continue
+		}
+
+		cmd, ok := command(p)
+		if !ok {
+			continue
+		}
+		switch {
+		case cmd.Kind == Function:
+			fn = &Func{Name: cmd.Name, NumLocals: cmd.N, Pos: cmd.Pos}
+			file.Funcs = append(file.Funcs, fn)
+		case fn == nil:
+			file.Commands = append(file.Commands, cmd)
+		default:
+			fn.Body = append(fn.Body, cmd)
+		}
+	}
+	if err := errs.Err(); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// command converts the current command of the parser. It returns false for comments and empty lines.
+func command(p *parser.Parser) (Command, bool) {
+	pos := Pos{File: p.File(), Line: p.Line()}
+	switch p.CommandType() {
+	case parser.C_ARITHMETRIC:
+		op, _ := lookup(opNames[:], p.Arg1())
+		return Command{Kind: Arithmetic, Op: Op(op), Pos: pos}, true
+	case parser.C_PUSH, parser.C_POP:
+		// the parser has checked the segment
+		segment, _ := lookup(segmentNames[:], p.Arg1())
+		kind := Push
+		if p.CommandType() == parser.C_POP {
+			kind = Pop
+		}
+		return Command{Kind: kind, Segment: Segment(segment), Index: p.Arg2(), Pos: pos}, true
+	case parser.C_LABEL:
+		return Command{Kind: Label, Name: p.Arg1(), Pos: pos}, true
+	case parser.C_GOTO:
+		return Command{Kind: Goto, Name: p.Arg1(), Pos: pos}, true
+	case parser.C_IF:
+		return Command{Kind: If, Name: p.Arg1(), Pos: pos}, true
+	case parser.C_FUNCTION:
+		return Command{Kind: Function, Name: p.Arg1(), N: p.Arg2(), Pos: pos}, true
+	case parser.C_CALL:
+		return Command{Kind: Call, Name: p.Arg1(), N: p.Arg2(), Pos: pos}, true
+	case parser.C_RETURN:
+		return Command{Kind: Return, Pos: pos}, true
+	}
+	return Command{}, false
+}
+
+// ParseFiles reads the vm files concurrently into a program, whose files are in the order of paths.
+// If the files have errors, all of them are returned as a parser.ErrorList.
+func ParseFiles(paths []string) (*Program, error) {
+	files := make([]*File, len(paths))
+	errs := make([]error, len(paths))
+	var wg sync.WaitGroup
+	for i, path := range paths {
+		wg.Add(1)
+		go func(i int, path string) {
+			defer wg.Done()
+			files[i], errs[i] = parseFile(path)
+		}(i, path)
+	}
+	wg.Wait()
+
+	var list parser.ErrorList
+	for _, err := range errs {
+		var l parser.ErrorList
+		switch {
+		case errors.As(err, &l):
+			list = append(list, l...)
+		case err != nil:
+			return nil, err
+		}
+	}
+	if err := list.Err(); err != nil {
+		return nil, err
+	}
+	return &Program{Files: files}, nil
+}
+
+func parseFile(path string) (*File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(path, f)
+}
@@ -0,0 +1,15 @@
+package vm
+
+import (
+	"bufio"
+	"io"
+)
+
+// Fprint writes the file as vm text, one command per line without comments.
+func Fprint(w io.Writer, file *File) error {
+	bw := bufio.NewWriter(w)
+	for _, cmd := range file.All() {
+		bw.WriteString(cmd.String() + "\n")
+	}
+	return bw.Flush()
+}
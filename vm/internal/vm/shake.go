@@ -0,0 +1,47 @@
+package vm
+
+// Reachable returns the functions which are called from the entry directly or indirectly, including the entry.
+// The functions which are not defined in the program are not followed.
+func (p *Program) Reachable(entry string) map[string]bool {
+	reached := map[string]bool{}
+	queue := []string{entry}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		f, _, ok := p.Func(name)
+		if !ok || reached[name] {
+			continue
+		}
+		reached[name] = true
+		for _, cmd := range f.Body {
+			if cmd.Kind == Call && !reached[cmd.Name] {
+				queue = append(queue, cmd.Name)
+			}
+		}
+	}
+	return reached
+}
+
+// Shake returns the program without the functions which are never called from the entry,
+// and the number of the removed functions. If the entry is not defined, the program is returned as it is.
+func (p *Program) Shake(entry string) (*Program, int) {
+	if _, _, ok := p.Func(entry); !ok {
+		return p, 0
+	}
+
+	reached := p.Reachable(entry)
+	shaken := &Program{}
+	removed := 0
+	for _, file := range p.Files {
+		f := &File{Path: file.Path, Name: file.Name, Commands: file.Commands}
+		for _, fn := range file.Funcs {
+			if !reached[fn.Name] {
+				removed += 1
+				continue
+			}
+			f.Funcs = append(f.Funcs, fn)
+		}
+		shaken.Files = append(shaken.Files, f)
+	}
+	return shaken, removed
+}
@@ -0,0 +1,47 @@
+package vm
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestShake(t *testing.T) {
+	files := []struct {
+		name string
+		src  string
+	}{
+		{name: "Sys.vm", src: "function Sys.init 0\ncall Main.main 0\nlabel HALT\ngoto HALT\n"},
+		{name: "Main.vm", src: "function Main.main 0\ncall Main.f 0\nreturn\nfunction Main.unused 0\ncall Main.f 0\nreturn\nfunction Main.f 0\ncall Main.f 0\nreturn\n"},
+		{name: "Math.vm", src: "function Math.multiply 2\npush constant 0\nreturn\n"},
+	}
+	prog := &Program{}
+	for _, f := range files {
+		file, err := Parse(f.name, strings.NewReader(f.src))
+		if err != nil {
+			t.Fatalf("Parse() = %v", err)
+		}
+		prog.Files = append(prog.Files, file)
+	}
+
+	shaken, removed := prog.Shake(SysInit)
+	if removed != 2 {
+		t.Errorf("Shake() removed %d functions, want 2", removed)
+	}
+	var got []string
+	for _, file := range shaken.Files {
+		for _, f := range file.Funcs {
+			got = append(got, f.Name)
+		}
+	}
+	if want := []string{"Sys.init", "Main.main", "Main.f"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Shake() = %v, want %v", got, want)
+	}
+	if len(prog.Files[1].Funcs) != 3 {
+		t.Errorf("Shake() modified the program")
+	}
+
+	if shaken, removed := prog.Shake("Main.undefined"); shaken != prog || removed != 0 {
+		t.Errorf("Shake() from an undefined function = %d removed, want the program as it is", removed)
+	}
+}
@@ -0,0 +1,218 @@
+// Package vm is the in-memory representation of vm programs.
+// A program is read by Parse, written back as vm text by Fprint,
+// and shared by the tools which analyze, optimize or run the programs.
+package vm
+
+import (
+	"fmt"
+
+	"github.com/uu64/nand2tetris/vm/internal/parser"
+)
+
+// Kind is the kind of a command.
+type Kind int
+
+const (
+	Arithmetic Kind = iota
+	Push
+	Pop
+	Label
+	Goto
+	If
+	Function
+	Call
+	Return
+)
+
+var kindNames = [...]string{
+	Arithmetic: "arithmetic",
+	Push:       parser.CMD_PUSH,
+	Pop:        parser.CMD_POP,
+	Label:      parser.CMD_LABEL,
+	Goto:       parser.CMD_GOTO,
+	If:         parser.CMD_IF,
+	Function:   parser.CMD_FUNC,
+	Call:       parser.CMD_CALL,
+	Return:     parser.CMD_RETURN,
+}
+
+func (k Kind) String() string {
+	if 0 <= int(k) && int(k) < len(kindNames) {
+		return kindNames[k]
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// Op is an arithmetic or logical command.
+type Op int
+
+const (
+	Add Op = iota
+	Sub
+	Neg
+	Eq
+	Gt
+	Lt
+	And
+	Or
+	Not
+)
+
+var opNames = [...]string{
+	Add: parser.CMD_ADD,
+	Sub: parser.CMD_SUB,
+	Neg: parser.CMD_NEG,
+	Eq:  parser.CMD_EQ,
+	Gt:  parser.CMD_GT,
+	Lt:  parser.CMD_LT,
+	And: parser.CMD_AND,
+	Or:  parser.CMD_OR,
+	Not: parser.CMD_NOT,
+}
+
+func (op Op) String() string {
+	if 0 <= int(op) && int(op) < len(opNames) {
+		return opNames[op]
+	}
+	return fmt.Sprintf("Op(%d)", int(op))
+}
+
+// Unary reports whether the operator takes one operand.
+func (op Op) Unary() bool {
+	return op == Neg || op == Not
+}
+
+// Segment is a memory segment.
+type Segment int
+
+const (
+	Argument Segment = iota
+	Local
+	Static
+	Constant
+	This
+	That
+	Pointer
+	Temp
+)
+
+var segmentNames = [...]string{
+	Argument: parser.SEG_ARG,
+	Local:    parser.SEG_LOCAL,
+	Static:   parser.SEG_STATIC,
+	Constant: parser.SEG_CONST,
+	This:     parser.SEG_THIS,
+	That:     parser.SEG_THAT,
+	Pointer:  parser.SEG_PTR,
+	Temp:     parser.SEG_TEMP,
+}
+
+func (s Segment) String() string {
+	if 0 <= int(s) && int(s) < len(segmentNames) {
+		return segmentNames[s]
+	}
+	return fmt.Sprintf("Segment(%d)", int(s))
+}
+
+// lookup returns the index of name in names.
+func lookup(names []string, name string) (int, bool) {
+	for i, n := range names {
+		if n == name {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// Pos is the location of a command in the source.
+type Pos struct {
+	File string
+	Line int
+}
+
+func (p Pos) String() string {
+	return fmt.Sprintf("%s:%d", p.File, p.Line)
+}
+
+// Command is a vm command. The fields which are not used by the kind are zero.
+type Command struct {
+	Kind Kind
+	// Op is the operator of an arithmetic command.
+	Op Op
+	// Segment and Index are the operands of push and pop.
+	Segment Segment
+	Index   int
+	// Name is the label of label, goto and if-goto, or the function of function and call.
+	Name string
+	// N is the number of local variables of function, or the number of arguments of call.
+	N   int
+	Pos Pos
+}
+
+// String returns the command in the vm language.
+func (c Command) String() string {
+	switch c.Kind {
+	case Arithmetic:
+		return c.Op.String()
+	case Push, Pop:
+		return fmt.Sprintf("%s %s %d", c.Kind, c.Segment, c.Index)
+	case Label, Goto, If:
+		return fmt.Sprintf("%s %s", c.Kind, c.Name)
+	case Function, Call:
+		return fmt.Sprintf("%s %s %d", c.Kind, c.Name, c.N)
+	case Return:
+		return c.Kind.String()
+	}
+	return fmt.Sprintf("unknown command %s", c.Kind)
+}
+
+// Func is a function and its body, which is the commands up to the next function.
+type Func struct {
+	Name      string
+	NumLocals int
+	Pos       Pos
+	Body      []Command
+}
+
+// Command returns the function command which declares the function.
+func (f *Func) Command() Command {
+	return Command{Kind: Function, Name: f.Name, N: f.NumLocals, Pos: f.Pos}
+}
+
+// File is a vm file.
+type File struct {
+	// Path is the path of the vm file, which is used in positions.
+	Path string
+	// Name is the file name without the directory and the extension, which names the static variables.
+	Name string
+	// Commands are the commands before the first function, which only test programs have.
+	Commands []Command
+	Funcs    []*Func
+}
+
+// All returns the commands of the file in order, including the function commands.
+func (file *File) All() []Command {
+	cmds := append([]Command{}, file.Commands...)
+	for _, f := range file.Funcs {
+		cmds = append(cmds, f.Command())
+		cmds = append(cmds, f.Body...)
+	}
+	return cmds
+}
+
+// Program is the vm files which are translated together.
+type Program struct {
+	Files []*File
+}
+
+// Func returns the function of the name in any file.
+func (p *Program) Func(name string) (*Func, *File, bool) {
+	for _, file := range p.Files {
+		for _, f := range file.Funcs {
+			if f.Name == name {
+				return f, file, true
+			}
+		}
+	}
+	return nil, nil, false
+}
@@ -0,0 +1,172 @@
+package vm
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/uu64/nand2tetris/vm/internal/parser"
+)
+
+func TestParse(t *testing.T) {
+	src := `// comment
+push constant 7
+function Main.main 2
+  push argument 0   // x
+  pop static 3
+label LOOP
+  lt
+  if-goto LOOP
+  call Math.multiply 2
+  return
+function Main.f 0
+  goto END
+`
+	file, err := Parse("dir/Main.vm", strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("Parse() = %v", err)
+	}
+	if file.Name != "Main" || file.Path != "dir/Main.vm" {
+		t.Errorf("Name, Path = %q, %q", file.Name, file.Path)
+	}
+
+	pos := func(line int) Pos { return Pos{File: "dir/Main.vm", Line: line} }
+	wantCommands := []Command{{Kind: Push, Segment: Constant, Index: 7, Pos: pos(2)}}
+	if !reflect.DeepEqual(file.Commands, wantCommands) {
+		t.Errorf("Commands = %v, want %v", file.Commands, wantCommands)
+	}
+	wantFuncs := []*Func{
+		{Name: "Main.main", NumLocals: 2, Pos: pos(3), Body: []Command{
+			{Kind: Push, Segment: Argument, Index: 0, Pos: pos(4)},
+			{Kind: Pop, Segment: Static, Index: 3, Pos: pos(5)},
+			{Kind: Label, Name: "LOOP", Pos: pos(6)},
+			{Kind: Arithmetic, Op: Lt, Pos: pos(7)},
+			{Kind: If, Name: "LOOP", Pos: pos(8)},
+			{Kind: Call, Name: "Math.multiply", N: 2, Pos: pos(9)},
+			{Kind: Return, Pos: pos(10)},
+		}},
+		{Name: "Main.f", Pos: pos(11), Body: []Command{
+			{Kind: Goto, Name: "END", Pos: pos(12)},
+		}},
+	}
+	if !reflect.DeepEqual(file.Funcs, wantFuncs) {
+		t.Errorf("Funcs = %v, want %v", file.Funcs, wantFuncs)
+	}
+}
+
+func TestParseError(t *testing.T) {
+	_, err := Parse("Main.vm", strings.NewReader("push constant 1\npop constant 1\npush temp 8\n"))
+	var errs parser.ErrorList
+	if !errors.As(err, &errs) {
+		t.Fatalf("Parse() = %v, want a parser.ErrorList", err)
+	}
+	if len(errs) != 2 || errs[0].Line != 2 || errs[1].Line != 3 {
+		t.Errorf("Parse() = %v, want errors at lines 2 and 3", errs)
+	}
+}
+
+// TestRoundTrip parses the vm files of the projects and the OS, prints them and parses the output again.
+func TestRoundTrip(t *testing.T) {
+	var paths []string
+	for _, dir := range []string{"../../../projects/07", "../../../projects/08", "../../../tools/OS"} {
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && filepath.Ext(path) == ".vm" {
+				paths = append(paths, path)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	prog, err := ParseFiles(paths)
+	if err != nil {
+		t.Fatalf("ParseFiles() = %v", err)
+	}
+	for _, file := range prog.Files {
+		var buf bytes.Buffer
+		if err := Fprint(&buf, file); err != nil {
+			t.Fatal(err)
+		}
+		got, err := Parse(file.Path, &buf)
+		if err != nil {
+			t.Fatalf("%s: Parse() of the output = %v", file.Path, err)
+		}
+		if !sameCommands(got, file) {
+			t.Errorf("%s: the output is parsed into different commands", file.Path)
+		}
+	}
+}
+
+// sameCommands compares the commands of the files ignoring the positions.
+func sameCommands(a, b *File) bool {
+	strip := func(f *File) *File {
+		g := &File{}
+		for _, cmd := range f.Commands {
+			cmd.Pos = Pos{}
+			g.Commands = append(g.Commands, cmd)
+		}
+		for _, fn := range f.Funcs {
+			h := &Func{Name: fn.Name, NumLocals: fn.NumLocals}
+			for _, cmd := range fn.Body {
+				cmd.Pos = Pos{}
+				h.Body = append(h.Body, cmd)
+			}
+			g.Funcs = append(g.Funcs, h)
+		}
+		return g
+	}
+	return reflect.DeepEqual(strip(a), strip(b))
+}
+
+func TestCheckLabels(t *testing.T) {
+	files := map[string]string{
+		"Main.vm": `function Main.main 0
+label LOOP
+goto LOOP
+label LOOP
+if-goto END
+return
+function Main.f 0
+label LOOP
+goto END
+goto NOWHERE
+label END
+return
+`,
+		"Sys.vm": `function Sys.init 0
+label LOOP
+goto LOOP
+`,
+	}
+
+	prog := &Program{}
+	for _, name := range []string{"Main.vm", "Sys.vm"} {
+		file, err := Parse(name, strings.NewReader(files[name]))
+		if err != nil {
+			t.Fatalf("Parse() = %v", err)
+		}
+		prog.Files = append(prog.Files, file)
+	}
+
+	var got []string
+	for _, err := range prog.CheckLabels() {
+		got = append(got, err.Error())
+	}
+	want := []string{
+		`Main.vm:4: duplicate label LOOP, first defined at line 2: "label LOOP"`,
+		`Main.vm:5: label END is defined in Main.f, not in Main.main: jumps across functions are not allowed: "if-goto END"`,
+		`Main.vm:10: undefined label NOWHERE: "goto NOWHERE"`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("CheckLabels() = %q, want %q", got, want)
+	}
+}
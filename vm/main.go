@@ -1,19 +1,132 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/uu64/nand2tetris/vm/cmd"
+	"github.com/uu64/nand2tetris/vm/internal/emulator"
+	"github.com/uu64/nand2tetris/vm/internal/parser"
 )
 
-var output = flag.String("o", "out.asm", "output file")
+const (
+	extVm  = ".vm"
+	extAsm = ".asm"
+
+	// sysFile is the file which defines Sys.init called by the bootstrap code.
+	sysFile = "Sys.vm"
+)
+
+var output = flag.String("o", "", "output file (default <Dir>.asm in the directory for a directory, or out.asm)")
 var noBootFlag = flag.Bool("noboot", false, "disable bootstrap")
+var compactFlag = flag.Bool("compact", false, "call shared routines for eq, gt, lt, call and return instead of inlining them")
+var optimizeFlag = flag.Bool("O", false, "cache the stack top in D and fuse commands which commonly appear in sequence")
+var checkFlag = flag.Bool("check", false, "check the call graph without translating")
+var runFlag = flag.Bool("run", false, "run the program on the vm emulator without translating")
+var entryFlag = flag.String("entry", "", "function to run with -run (default Sys.init if defined, or the first command)")
+var stepsFlag = flag.Int("steps", 0, "maximum number of commands to run with -run (default no limit)")
+var ramFlag = flag.String("ram", "", "RAM addresses to print after -run, such as 0-4,256")
 
 func usage() {
-	fmt.Println("usage: vmc [-o output] input [input ...]")
+	fmt.Println("usage: vmc [-o output] [-noboot] [-compact] [-O] [-check] [-run [-entry function] [-steps n] [-ram addrs]] input [input ...]")
+}
+
+// inputs returns the vm files given by the arguments. A directory gives the vm files directly in it.
+func inputs(args []string) ([]string, error) {
+	paths := []string{}
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			paths = append(paths, arg)
+			continue
+		}
+
+		entries, err := os.ReadDir(arg)
+		if err != nil {
+			return nil, err
+		}
+		found := false
+		for _, e := range entries {
+			if !e.IsDir() && filepath.Ext(e.Name()) == extVm {
+				paths = append(paths, filepath.Join(arg, e.Name()))
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no vm files in %s", arg)
+		}
+	}
+	return paths, nil
+}
+
+// defaultOutput returns the output file when -o is not given.
+// A directory Xxx is translated into Xxx/Xxx.asm like the VMTranslator of the book, and files into out.asm.
+func defaultOutput(args []string) string {
+	if len(args) != 1 {
+		return "out.asm"
+	}
+	arg := filepath.Clean(args[0])
+	if info, err := os.Stat(arg); err == nil && info.IsDir() {
+		return filepath.Join(arg, filepath.Base(arg)+extAsm)
+	}
+	return "out.asm"
+}
+
+// hasSys reports whether the vm files include Sys.vm, which the bootstrap code needs.
+func hasSys(paths []string) bool {
+	for _, path := range paths {
+		if filepath.Base(path) == sysFile {
+			return true
+		}
+	}
+	return false
+}
+
+// bootstrap reports whether the bootstrap code is written for the inputs.
+// Directories without Sys.vm, such as those of projects/07, are translated without it,
+// while files are always bootstrapped unless -noboot is given.
+func bootstrap(args, paths []string) bool {
+	for _, arg := range args {
+		if info, err := os.Stat(arg); err != nil || !info.IsDir() {
+			return true
+		}
+	}
+	return hasSys(paths)
+}
+
+// ramAddresses parses a comma-separated list of RAM addresses and ranges such as "0-4,256".
+func ramAddresses(s string) ([]int, error) {
+	addrs := []int{}
+	if s == "" {
+		return addrs, nil
+	}
+	for _, field := range strings.Split(s, ",") {
+		lo, hi := field, field
+		if i := strings.Index(field, "-"); i >= 0 {
+			lo, hi = field[:i], field[i+1:]
+		}
+		from, err := strconv.Atoi(lo)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RAM address %s", field)
+		}
+		to, err := strconv.Atoi(hi)
+		if err != nil || from < 0 || to < from || emulator.RAMSize <= to {
+			return nil, fmt.Errorf("invalid RAM address %s", field)
+		}
+		for addr := from; addr <= to; addr++ {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs, nil
 }
 
 func main() {
@@ -24,9 +137,58 @@ func main() {
 
 	flag.Parse()
 
-	cmd := cmd.New(flag.Args(), *output, *noBootFlag)
-	if err := cmd.Run(); err != nil {
+	paths, err := inputs(flag.Args())
+	if err != nil {
+		log.Fatal(err)
+	}
+	addrs, err := ramAddresses(*ramFlag)
+	if err != nil {
 		log.Fatal(err)
 	}
-	fmt.Printf("output: %s\n", *output)
+	asmfilePath := *output
+	if asmfilePath == "" {
+		asmfilePath = defaultOutput(flag.Args())
+	}
+
+	opts := cmd.Options{
+		DisableBootstrap: *noBootFlag || !bootstrap(flag.Args(), paths),
+		Compact:          *compactFlag,
+		Optimize:         *optimizeFlag,
+	}
+
+	cmd := cmd.New(paths, asmfilePath, opts)
+	run := cmd.Run
+	switch {
+	case *checkFlag:
+		run = cmd.Check
+	case *runFlag:
+		run = func() error {
+			m, err := cmd.Emulate(*entryFlag, *stepsFlag)
+			// the RAM is printed even if the step limit is exceeded, which is reported as an error
+			if m != nil {
+				fmt.Printf("steps: %d\n", m.Steps)
+				for _, addr := range addrs {
+					fmt.Printf("RAM[%d]: %d\n", addr, m.RAM[addr])
+				}
+			}
+			if errors.Is(err, emulator.ErrStepLimit) {
+				return fmt.Errorf("%w after %d steps", err, m.Steps)
+			}
+			return err
+		}
+	}
+	if err := run(); err != nil {
+		var errs parser.ErrorList
+		if !errors.As(err, &errs) {
+			log.Fatal(err)
+		}
+		for _, e := range errs {
+			fmt.Fprintln(os.Stderr, e)
+		}
+		os.Exit(1)
+	}
+	if *checkFlag || *runFlag {
+		return
+	}
+	fmt.Printf("output: %s\n", asmfilePath)
 }
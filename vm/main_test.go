@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var projects = filepath.Join("..", "projects")
+
+func TestInputs(t *testing.T) {
+	simpleAdd := filepath.Join(projects, "07", "StackArithmetic", "SimpleAdd")
+	fibonacci := filepath.Join(projects, "08", "FunctionCalls", "FibonacciElement")
+	main := filepath.Join(fibonacci, "Main.vm")
+	empty := t.TempDir()
+
+	tests := []struct {
+		name      string
+		args      []string
+		paths     []string
+		output    string
+		bootstrap bool
+	}{
+		{
+			name:      "projects/07 directory",
+			args:      []string{simpleAdd},
+			paths:     []string{filepath.Join(simpleAdd, "SimpleAdd.vm")},
+			output:    filepath.Join(simpleAdd, "SimpleAdd.asm"),
+			bootstrap: false,
+		},
+		{
+			name:      "projects/08 directory with Sys.vm",
+			args:      []string{fibonacci + string(filepath.Separator)},
+			paths:     []string{main, filepath.Join(fibonacci, "Sys.vm")},
+			output:    filepath.Join(fibonacci, "FibonacciElement.asm"),
+			bootstrap: true,
+		},
+		{
+			name:      "file without Sys.vm",
+			args:      []string{main},
+			paths:     []string{main},
+			output:    "out.asm",
+			bootstrap: true,
+		},
+		{
+			name:      "files",
+			args:      []string{main, filepath.Join(simpleAdd, "SimpleAdd.vm")},
+			paths:     []string{main, filepath.Join(simpleAdd, "SimpleAdd.vm")},
+			output:    "out.asm",
+			bootstrap: true,
+		},
+		{
+			name:      "directories",
+			args:      []string{simpleAdd, fibonacci},
+			paths:     []string{filepath.Join(simpleAdd, "SimpleAdd.vm"), main, filepath.Join(fibonacci, "Sys.vm")},
+			output:    "out.asm",
+			bootstrap: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			paths, err := inputs(tt.args)
+			if err != nil {
+				t.Fatalf("inputs() = %v", err)
+			}
+			if strings.Join(paths, " ") != strings.Join(tt.paths, " ") {
+				t.Errorf("inputs() = %v, want %v", paths, tt.paths)
+			}
+			if output := defaultOutput(tt.args); output != tt.output {
+				t.Errorf("defaultOutput() = %s, want %s", output, tt.output)
+			}
+			if got := bootstrap(tt.args, paths); got != tt.bootstrap {
+				t.Errorf("bootstrap() = %v, want %v", got, tt.bootstrap)
+			}
+		})
+	}
+
+	t.Run("empty directory", func(t *testing.T) {
+		if paths, err := inputs([]string{empty}); err == nil {
+			t.Errorf("inputs() = %v, want an error", paths)
+		}
+		if output := defaultOutput([]string{empty}); output != filepath.Join(empty, filepath.Base(empty)+".asm") {
+			t.Errorf("defaultOutput() = %s", output)
+		}
+	})
+}
+
+func TestHasSys(t *testing.T) {
+	if hasSys([]string{"a/Main.vm", "a/Foo.vm"}) {
+		t.Errorf("hasSys() without Sys.vm = true")
+	}
+	if !hasSys([]string{"a/Main.vm", "a/Sys.vm"}) {
+		t.Errorf("hasSys() with Sys.vm = false")
+	}
+	if hasSys(nil) {
+		t.Errorf("hasSys() of no files = true")
+	}
+}
+
+func TestRAMAddresses(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+	}{
+		{s: "", want: ""},
+		{s: "0", want: "0"},
+		{s: "0-4,256", want: "0 1 2 3 4 256"},
+		{s: "261,0", want: "261 0"},
+		{s: "32767", want: "32767"},
+	}
+	for _, tt := range tests {
+		addrs, err := ramAddresses(tt.s)
+		if err != nil {
+			t.Errorf("ramAddresses(%q) = %v", tt.s, err)
+			continue
+		}
+		if got := strings.Trim(fmt.Sprint(addrs), "[]"); got != tt.want {
+			t.Errorf("ramAddresses(%q) = %s, want %s", tt.s, got, tt.want)
+		}
+	}
+
+	for _, s := range []string{"x", "1-", "-1", "4-0", "32768", "0,,1", "0-32768"} {
+		if addrs, err := ramAddresses(s); err == nil {
+			t.Errorf("ramAddresses(%q) = %v, want an error", s, addrs)
+		}
+	}
+}